@@ -1,14 +1,80 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"image"
+	"io"
+	"io/fs"
+	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/exp/shiny/screen"
 
 	"github.com/roman-mazur/architecture-lab-3/painter"
 	"github.com/roman-mazur/architecture-lab-3/painter/lang"
 	"github.com/roman-mazur/architecture-lab-3/ui"
+	"github.com/roman-mazur/architecture-lab-3/ui/headless"
+)
+
+var (
+	addr    = flag.String("addr", "localhost:17000", "HTTP listen address")
+	tlsCert = flag.String("tls-cert", "", "TLS certificate file; HTTPS is served when set together with -tls-key")
+	tlsKey  = flag.String("tls-key", "", "TLS private key file")
+
+	tokensPath = flag.String("tokens", "", "file with access tokens in the name:secret:perm[,perm] format; "+
+		"defaults to the "+lang.TokensEnv+" environment variable, authentication is disabled when neither is set")
+
+	headlessMode = flag.Bool("headless", false, "render frames without a window")
+	outPath      = flag.String("out", "frame.png", "file to write frames to in headless mode")
+
+	width        = flag.Int("width", ui.DefaultWidth, "window width")
+	height       = flag.Int("height", ui.DefaultHeight, "window height")
+	canvasWidth  = flag.Int("canvas-width", painter.DefaultSize.X, "width of the rendered canvas")
+	canvasHeight = flag.Int("canvas-height", painter.DefaultSize.Y, "height of the rendered canvas")
+
+	statePath = flag.String("state", "", "file to restore the scene from on start and to save it to on exit")
+	stateDir  = flag.String("state-dir", ".", "directory for scenes stored by the save and load commands")
+
+	queueCap    = flag.Int("queue-cap", 0, "maximum number of pending operations; 0 means unlimited")
+	queuePolicy = flag.String("queue-policy", "block", "what to do when the queue is full: block, drop-oldest or reject")
+	coalesce    = flag.Bool("coalesce", false, "merge pending fill, move and update commands so that only the latest state is drawn")
+	maxFPS      = flag.Float64("max-fps", 0, "maximum number of frames per second; 0 means unlimited")
+	rate        = flag.Float64("rate", 0, "maximum command requests per second per client; 0 disables rate limiting")
+	burst       = flag.Int("burst", 10, "number of requests a client may send at once before -rate applies")
+
+	tcpAddr = flag.String("tcp", "", "address of an optional plain TCP listener for line-based commands, e.g. localhost:17001; "+
+		"not allowed together with access tokens")
+	unixSocket = flag.String("unix", "", "path of an optional Unix domain socket for line-based commands; "+
+		"not allowed together with access tokens")
 )
 
 func main() {
+	flag.Parse()
+	if *width <= 0 || *height <= 0 || *canvasWidth <= 0 || *canvasHeight <= 0 {
+		log.Fatalf("Window and canvas sizes must be positive")
+	}
+	policies := map[string]painter.QueuePolicy{
+		"block":       painter.QueueBlock,
+		"drop-oldest": painter.QueueDropOldest,
+		"reject":      painter.QueueReject,
+	}
+	policy, ok := policies[*queuePolicy]
+	if !ok {
+		log.Fatalf("Unknown queue policy %q", *queuePolicy)
+	}
+	if (*tlsCert == "") != (*tlsKey == "") {
+		log.Fatalf("Both -tls-cert and -tls-key must be set to enable TLS")
+	}
+
 	var (
 		pv ui.Visualizer // Візуалізатор створює вікно та малює у ньому.
 
@@ -17,17 +83,207 @@ func main() {
 		parser lang.Parser  // Парсер команд.
 	)
 
-	//pv.Debug = true
-	pv.Title = "Simple painter"
+	opLoop.Size = image.Pt(*canvasWidth, *canvasHeight)
+	opLoop.QueueCap, opLoop.QueuePolicy = *queueCap, policy
+	opLoop.Coalesce, opLoop.MaxFPS = *coalesce, *maxFPS
+	parser.StateDir = *stateDir
+
+	if *statePath != "" {
+		restoreState(&opLoop, *statePath)
+	}
+
+	auth := loadAuth(*tokensPath)
+	// Рядковий протокол не передає токени, тому з увімкненою автентифікацією він відкрив би доступ в обхід неї.
+	if auth != nil && (*tcpAddr != "" || *unixSocket != "") {
+		log.Fatalf("Line listeners (-tcp, -unix) do not support authentication and cannot be used with access tokens")
+	}
+	var limiter *lang.RateLimiter
+	if *rate > 0 {
+		limiter = lang.NewRateLimiter(*rate, *burst)
+	}
+
+	mux := http.NewServeMux()
+	srv := &http.Server{Addr: *addr, Handler: mux}
+	mux.Handle("/", auth.Require(lang.PermDraw, limiter.Limit(lang.HttpHandler(&opLoop, &parser))))
+	mux.Handle("/frame.png", auth.Require(lang.PermRead, lang.FrameHandler(&opLoop)))
+	mux.Handle("/state", auth.Require(lang.PermRead, lang.StateHandler(&opLoop)))
+	mux.Handle("/save", auth.Require(lang.PermDraw|lang.PermReset, limiter.Limit(lang.SaveHandler(&opLoop, &parser))))
+	mux.Handle("/load", auth.Require(lang.PermDraw|lang.PermReset, limiter.Limit(lang.LoadHandler(&opLoop, &parser))))
+	mux.Handle("/ws", auth.Require(lang.PermDraw, limiter.Limit(lang.WebSocketHandler(&opLoop, &parser))))
+	mux.Handle("/events", auth.Require(lang.PermRead, endOnShutdown(srv, lang.EventsHandler(&opLoop))))
+	serveHTTP(srv, *tlsCert, *tlsKey)
+
+	lines := lang.LineServer{Loop: &opLoop, Parser: &parser}
+	if *tcpAddr != "" {
+		serveLines(&lines, "tcp", *tcpAddr)
+	}
+	if *unixSocket != "" {
+		removeStaleSocket(*unixSocket)
+		serveLines(&lines, "unix", *unixSocket)
+	}
+
+	if *headlessMode {
+		// Без вікна кожен кадр записується у файл, а робота завершується сигналом.
+		opLoop.Receiver = &headless.PNGReceiver{Path: *outPath}
+		if err := opLoop.Start(headless.Screen{}); err != nil {
+			log.Fatalf("Cannot start the painter loop: %s", err)
+		}
+
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+	} else {
+		//pv.Debug = true
+		pv.Title = "Simple painter"
+		pv.Width, pv.Height = *width, *height
+
+		pv.OnScreenReady = func(s screen.Screen) {
+			if err := opLoop.Start(s); err != nil {
+				log.Fatalf("Cannot start the painter loop: %s", err)
+			}
+		}
+		opLoop.Receiver = &pv
 
-	pv.OnScreenReady = opLoop.Start
-	opLoop.Receiver = &pv
+		pv.Main()
+	}
+	// Спочатку дочікуємося запитів, які ще виконуються, і лише потім зупиняємо цикл, що їх обслуговує.
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("HTTP server shutdown: %s", err)
+	}
+	cancel()
+	_ = lines.Close()
+
+	// Після закриття вікна Receiver більше не приймає кадри, тому цикл може не завершитися самостійно.
+	ctx, cancel = context.WithTimeout(context.Background(), shutdownTimeout)
+	if err := opLoop.Stop(ctx); err != nil {
+		log.Printf("Painter loop did not stop: %s", err)
+	}
+	cancel()
+
+	if *statePath != "" {
+		if err := painter.SaveScene(*statePath, opLoop.Scene()); err != nil {
+			log.Printf("Cannot save scene: %s", err)
+		}
+	}
+}
+
+// Максимальний час, протягом якого сервер чекає завершення активних запитів, а цикл - виконання черги під час зупинки.
+const shutdownTimeout = 10 * time.Second
+
+// serveHTTP відкриває адресу сервера та починає обслуговувати запити. Помилки запуску (зайнята адреса,
+// некоректний сертифікат) завершують процес з ненульовим кодом.
+func serveHTTP(srv *http.Server, certFile, keyFile string) {
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		log.Fatalf("Cannot listen on %s: %s", srv.Addr, err)
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			log.Fatalf("Cannot load TLS certificate: %s", err)
+		}
+		srv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+		ln = tls.NewListener(ln, srv.TLSConfig)
+	}
+	log.Printf("Serving HTTP on %s", ln.Addr())
 
 	go func() {
-		http.Handle("/", lang.HttpHandler(&opLoop, &parser))
-		_ = http.ListenAndServe("localhost:17000", nil)
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("HTTP server failed: %s", err)
+		}
 	}()
+}
+
+// endOnShutdown завершує довготривалі запити обробника h (потоки подій) на початку зупинки сервера,
+// інакше Shutdown чекав би на них до завершення тайм-ауту.
+func endOnShutdown(srv *http.Server, h http.Handler) http.Handler {
+	done := make(chan struct{})
+	srv.RegisterOnShutdown(func() {
+		close(done)
+	})
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		go func() {
+			select {
+			case <-done:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		h.ServeHTTP(rw, r.WithContext(ctx))
+	})
+}
+
+// loadAuth читає токени доступу з файлу path або зі змінної оточення. Повертає nil, якщо токени не задано.
+func loadAuth(path string) *lang.Auth {
+	var in io.Reader
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			log.Fatalf("Cannot read tokens: %s", err)
+		}
+		defer f.Close()
+		in = f
+	} else if env := os.Getenv(lang.TokensEnv); env != "" {
+		in = strings.NewReader(env)
+	} else {
+		return nil
+	}
+
+	tokens, err := lang.ParseTokens(in)
+	if err != nil {
+		log.Fatalf("Cannot parse tokens: %s", err)
+	}
+	if len(tokens) == 0 {
+		log.Fatalf("No access tokens are configured")
+	}
+	return lang.NewAuth(tokens)
+}
+
+// serveLines запускає обробку рядкових команд на вказаній адресі.
+func serveLines(s *lang.LineServer, network, addr string) {
+	ln, err := net.Listen(network, addr)
+	if err != nil {
+		log.Fatalf("Cannot listen on %s %s: %s", network, addr, err)
+	}
+	go func() {
+		if err := s.Serve(ln); err != nil && !errors.Is(err, lang.ErrServerClosed) {
+			log.Printf("Line server on %s %s stopped: %s", network, addr, err)
+		}
+	}()
+}
+
+// removeStaleSocket видаляє файл сокета, що залишився після аварійного завершення попереднього запуску.
+// Сокет, на якому ще слухає інший процес, не видаляється: у такому разі painter не запускається.
+func removeStaleSocket(path string) {
+	if fi, err := os.Stat(path); err != nil || fi.Mode()&fs.ModeSocket == 0 {
+		return
+	}
+	conn, err := net.Dial("unix", path)
+	if err == nil {
+		conn.Close()
+		log.Fatalf("Socket %s is already used by another process", path)
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		_ = os.Remove(path)
+	}
+}
 
-	pv.Main()
-	opLoop.StopAndWait()
+// restoreState відновлює сцену, збережену під час попереднього запуску. Відсутність файлу не є помилкою.
+func restoreState(l *painter.Loop, path string) {
+	saved, err := painter.LoadScene(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Cannot restore scene: %s", err)
+	}
+	l.Post(painter.OperationList{
+		painter.OperationFunc(func(s *painter.Scene) {
+			painter.Restore(s, saved)
+		}),
+		painter.UpdateOp,
+	})
 }
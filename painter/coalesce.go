@@ -0,0 +1,83 @@
+package painter
+
+// Coalescable реалізують операції, які повністю перезаписують частину стану сцени, тому з кількох таких операцій
+// з однаковим ключем у черзі достатньо виконати лише останню. Наприклад, заливка фону або переміщення фігур
+// за одним селектором. Операція з порожнім ключем не зливається з іншими.
+//
+// Злиття вмикається через Loop.Coalesce і відбувається лише в межах "хвоста" черги, що складається з операцій
+// з ключами. Будь-яка інша операція (зокрема передана через Exec) розділяє чергу, тому її порядок відносно
+// інших операцій не змінюється.
+type Coalescable interface {
+	Operation
+	CoalesceKey() string
+}
+
+// UpdateKey - ключ операції оновлення. Поки кадр ще не відправлено, нові операції з ключами додаються перед
+// оновленням, яке очікує у черзі, а повторні оновлення відкидаються.
+const UpdateKey = "update"
+
+func (op updateOp) CoalesceKey() string {
+	return UpdateKey
+}
+
+// coalesceKey повертає ключ операції. Список з однієї операції має ключ цієї операції.
+func coalesceKey(op Operation) string {
+	switch op := op.(type) {
+	case OperationList:
+		if len(op) == 1 {
+			return coalesceKey(op[0])
+		}
+	case Coalescable:
+		return op.CoalesceKey()
+	}
+	return ""
+}
+
+// tail повертає індекс, з якого починаються операції з ключами в кінці черги, та індекс оновлення серед них.
+// Оновлення завжди стоїть останнім, тому якщо його немає, повертається len(mq.messages).
+func (mq *messageQueue) tail() (start, update int) {
+	start, update = len(mq.messages), len(mq.messages)
+	for start > 0 && coalesceKey(mq.messages[start-1]) != "" {
+		start--
+	}
+	if start < len(mq.messages) && coalesceKey(mq.messages[len(mq.messages)-1]) == UpdateKey {
+		update = len(mq.messages) - 1
+	}
+	return
+}
+
+// merge зливає op з операціями в кінці черги без збільшення її довжини. Повертає false, якщо op потрібно додати
+// у чергу звичайним чином.
+func (mq *messageQueue) merge(op Operation) bool {
+	key := coalesceKey(op)
+	if key == "" {
+		return false
+	}
+
+	start, update := mq.tail()
+	if key == UpdateKey {
+		return update < len(mq.messages)
+	}
+	for i := start; i < update; i++ {
+		if coalesceKey(mq.messages[i]) == key {
+			// Попередня операція з тим самим ключем більше не потрібна; нова стає в кінець, але перед оновленням.
+			copy(mq.messages[i:], mq.messages[i+1:update])
+			mq.messages[update-1] = op
+			return true
+		}
+	}
+	return false
+}
+
+// insertPos повертає позицію, на яку потрібно додати op: операції з ключами стають перед оновленням, яке очікує
+// в кінці черги, щоб воно відобразило і їх.
+func (mq *messageQueue) insertPos(op Operation) int {
+	if !mq.coalesce {
+		return len(mq.messages)
+	}
+	if key := coalesceKey(op); key == "" || key == UpdateKey {
+		return len(mq.messages)
+	}
+	_, update := mq.tail()
+	return update
+}
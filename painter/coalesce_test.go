@@ -0,0 +1,98 @@
+package painter
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"golang.org/x/exp/shiny/screen"
+)
+
+// keyedOp - операція з ключем злиття, яка записує своє ім'я у ran.
+type keyedOp struct {
+	name, key string
+	ran       *[]string
+}
+
+func (op keyedOp) Do(t screen.Texture, s *Scene) bool {
+	*op.ran = append(*op.ran, op.name)
+	return false
+}
+
+func (op keyedOp) CoalesceKey() string {
+	return op.key
+}
+
+func TestLoop_Coalesce(t *testing.T) {
+	var (
+		l   = Loop{Coalesce: true}
+		tr  testReceiver
+		ran []string
+	)
+	l.Receiver = &tr
+	l.Start(mockScreen{})
+
+	started, blocked := make(chan struct{}), make(chan struct{})
+	l.Post(OperationFunc(func(*Scene) {
+		close(started)
+		<-blocked
+	}))
+	<-started
+
+	op := func(name, key string) Operation {
+		return keyedOp{name: name, key: key, ran: &ran}
+	}
+
+	// Потік пар move/update, як від scripts/move.sh.
+	l.Post(op("move t1 a", "move t1"))
+	l.Post(UpdateOp)
+	l.Post(op("move t2 a", "move t2"))
+	l.Post(OperationList{UpdateOp})
+	l.Post(OperationList{op("move t1 b", "move t1")})
+	l.Post(UpdateOp)
+	// Операція без ключа розділяє чергу: після неї злиття починається знову.
+	l.Post(op("figure", ""))
+	l.Post(op("move t1 c", "move t1"))
+	l.Post(UpdateOp)
+	l.Post(op("fill a", "fill"))
+	l.Post(op("fill b", "fill"))
+
+	if n := l.Pending(); n != 7 {
+		t.Errorf("Queue contains %d operations, expected 7", n)
+	}
+
+	close(blocked)
+	res, err := l.Exec(context.Background(), UpdateOp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.StopAndWait()
+
+	want := []string{"move t2 a", "move t1 b", "figure", "move t1 c", "fill b"}
+	if !reflect.DeepEqual(ran, want) {
+		t.Errorf("Executed %v, expected %v", ran, want)
+	}
+	// Оновлення перед figure, оновлення після fill b та оновлення з Exec.
+	if res.Frame != 3 {
+		t.Errorf("Loop sent %d frames, expected 3", res.Frame)
+	}
+}
+
+func TestLoop_NoCoalesce(t *testing.T) {
+	var (
+		l   Loop
+		tr  testReceiver
+		ran []string
+	)
+	l.Receiver = &tr
+	l.Start(mockScreen{})
+	for _, name := range []string{"a", "b", "c"} {
+		l.Post(keyedOp{name: name, key: "fill", ran: &ran})
+		l.Post(UpdateOp)
+	}
+	l.StopAndWait()
+
+	if !reflect.DeepEqual(ran, []string{"a", "b", "c"}) || l.Frame() != 3 {
+		t.Errorf("Operations were merged without Coalesce: %v, %d frames", ran, l.Frame())
+	}
+}
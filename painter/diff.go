@@ -0,0 +1,121 @@
+package painter
+
+import (
+	"encoding/json"
+	"image/color"
+	"strconv"
+)
+
+// SceneDiff описує зміни між двома станами сцени.
+type SceneDiff struct {
+	Background color.Color // Новий колір фону; nil, якщо фон не змінився
+
+	RectsChanged bool   // Чи змінився список прямокутників
+	Rects        []Rect // Новий список прямокутників, якщо він змінився
+
+	FiguresAdded   []Figure // Нові фігури
+	FiguresChanged []Figure // Фігури, які змінили положення, розмір або колір (у новому стані)
+	FiguresRemoved []Figure // Фігури, яких більше немає на сцені (у попередньому стані)
+}
+
+// Empty перевіряє, чи немає жодних змін.
+func (d SceneDiff) Empty() bool {
+	return d.Background == nil && !d.RectsChanged &&
+		len(d.FiguresAdded) == 0 && len(d.FiguresChanged) == 0 && len(d.FiguresRemoved) == 0
+}
+
+// Diff порівнює два стани сцени. Порожня (nil) попередня сцена вважається щойно створеною через NewScene.
+// Фігури з id порівнюються за id, а фігури без id - за їх позицією у списку фігур сцени.
+func Diff(prev, cur *Scene) SceneDiff {
+	if prev == nil {
+		prev = NewScene()
+	}
+
+	var d SceneDiff
+	if !sameColor(prev.Bgc, cur.Bgc) {
+		d.Background = cur.Bgc
+	}
+
+	if !sameRects(prev.BRects, cur.BRects) {
+		d.RectsChanged = true
+		d.Rects = append([]Rect{}, cur.BRects...)
+	}
+
+	prevFigures := make(map[string]Figure, len(prev.Figures))
+	for i, f := range prev.Figures {
+		prevFigures[figureKey(i, f)] = f
+	}
+	for i, f := range cur.Figures {
+		key := figureKey(i, f)
+		old, ok := prevFigures[key]
+		switch {
+		case !ok:
+			d.FiguresAdded = append(d.FiguresAdded, f)
+		case !sameFigure(old, f):
+			d.FiguresChanged = append(d.FiguresChanged, f)
+		}
+		delete(prevFigures, key)
+	}
+	for i, f := range prev.Figures {
+		if _, ok := prevFigures[figureKey(i, f)]; ok {
+			d.FiguresRemoved = append(d.FiguresRemoved, f)
+		}
+	}
+	return d
+}
+
+func figureKey(i int, f Figure) string {
+	if f.ID != "" {
+		return "id:" + f.ID
+	}
+	return "#" + strconv.Itoa(i)
+}
+
+func sameColor(a, b color.Color) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	ar, ag, ab, aa := a.RGBA()
+	br, bg, bb, ba := b.RGBA()
+	return ar == br && ag == bg && ab == bb && aa == ba
+}
+
+func sameRects(a, b []Rect) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].X1 != b[i].X1 || a[i].Y1 != b[i].Y1 || a[i].X2 != b[i].X2 || a[i].Y2 != b[i].Y2 ||
+			!sameColor(a[i].Color, b[i].Color) {
+			return false
+		}
+	}
+	return true
+}
+
+func sameFigure(a, b Figure) bool {
+	return a.ID == b.ID && a.X == b.X && a.Y == b.Y && a.Scale == b.Scale && sameColor(a.Color, b.Color)
+}
+
+type diffJSON struct {
+	Background     *hexColor `json:"background,omitempty"`
+	Rects          *[]Rect   `json:"rects,omitempty"`
+	FiguresAdded   []Figure  `json:"figures_added,omitempty"`
+	FiguresChanged []Figure  `json:"figures_changed,omitempty"`
+	FiguresRemoved []Figure  `json:"figures_removed,omitempty"`
+}
+
+func (d SceneDiff) MarshalJSON() ([]byte, error) {
+	v := diffJSON{
+		FiguresAdded:   d.FiguresAdded,
+		FiguresChanged: d.FiguresChanged,
+		FiguresRemoved: d.FiguresRemoved,
+	}
+	if d.Background != nil {
+		v.Background = &hexColor{d.Background}
+	}
+	if d.RectsChanged {
+		v.Rects = &d.Rects
+	}
+	return json.Marshal(v)
+}
@@ -0,0 +1,43 @@
+package painter
+
+import (
+	"encoding/json"
+	"image/color"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	prev := NewScene()
+	DrawFigure(prev, Figure{ID: "a", X: 0.1, Y: 0.1, Color: DefaultFigureColor})
+	DrawFigure(prev, Figure{ID: "b", X: 0.2, Y: 0.2, Color: DefaultFigureColor})
+	DrawFigure(prev, Figure{X: 0.3, Y: 0.3, Color: DefaultFigureColor})
+
+	if d := Diff(prev, prev.Clone()); !d.Empty() {
+		t.Error("Diff of equal scenes is not empty:", d)
+	}
+
+	cur := prev.Clone()
+	WhiteFill(cur)
+	DrawBgRect(cur, []float64{0, 0, 0.5, 0.5}, color.Black)
+	Move(cur, "a", []float64{0.5, 0.5})
+	cur.Figures = append(cur.Figures[:1], cur.Figures[2:]...) // Видаляємо b.
+	DrawFigure(cur, Figure{ID: "c", X: 0.9, Y: 0.9, Color: DefaultFigureColor})
+
+	data, err := json.Marshal(Diff(prev, cur))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Фігура без id змістилася у списку з позиції 2 на 1, тому вважається видаленою та доданою.
+	want := `{"background":"#ffffffff","rects":[{"x1":0,"y1":0,"x2":0.5,"y2":0.5,"color":"#000000ff"}],` +
+		`"figures_added":[{"x":0.3,"y":0.3,"scale":1,"color":"#ffff00ff"},{"id":"c","x":0.9,"y":0.9,"scale":1,"color":"#ffff00ff"}],` +
+		`"figures_changed":[{"id":"a","x":0.5,"y":0.5,"scale":1,"color":"#ffff00ff"}],` +
+		`"figures_removed":[{"id":"b","x":0.2,"y":0.2,"scale":1,"color":"#ffff00ff"},{"x":0.3,"y":0.3,"scale":1,"color":"#ffff00ff"}]}`
+	if string(data) != want {
+		t.Errorf("Unexpected diff:\n%s\nexpected:\n%s", data, want)
+	}
+
+	Reset(cur)
+	if d := Diff(nil, cur); !d.Empty() {
+		t.Error("Diff of a reset scene and an empty scene is not empty:", d)
+	}
+}
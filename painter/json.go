@@ -0,0 +1,182 @@
+package painter
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Стан сцени кодується у JSON з кольорами у форматі "#rrggbbaa", наприклад:
+//
+//	{"background":"#000000ff","rects":[{"x1":0.1,"y1":0.1,"x2":0.9,"y2":0.9,"color":"#000000ff"}],
+//	 "figures":[{"id":"t1","x":0.5,"y":0.5,"scale":1,"color":"#ffff00ff"}]}
+//
+// Кольори, яких немає у JSON, замінюються кольорами за замовчуванням.
+
+type sceneJSON struct {
+	Background hexColor `json:"background"`
+	Rects      []Rect   `json:"rects"`
+	Figures    []Figure `json:"figures"`
+}
+
+func (s *Scene) MarshalJSON() ([]byte, error) {
+	v := sceneJSON{
+		Background: hexColor{s.Bgc},
+		Rects:      s.BRects,
+		Figures:    s.Figures,
+	}
+	// Порожні списки кодуються як [], а не null.
+	if v.Rects == nil {
+		v.Rects = []Rect{}
+	}
+	if v.Figures == nil {
+		v.Figures = []Figure{}
+	}
+	return json.Marshal(v)
+}
+
+func (s *Scene) UnmarshalJSON(data []byte) error {
+	var v sceneJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*s = Scene{
+		Bgc:     v.Background.or(DefaultBgColor),
+		BRects:  v.Rects,
+		Figures: v.Figures,
+	}
+	return nil
+}
+
+type rectJSON struct {
+	X1    float64  `json:"x1"`
+	Y1    float64  `json:"y1"`
+	X2    float64  `json:"x2"`
+	Y2    float64  `json:"y2"`
+	Color hexColor `json:"color"`
+}
+
+func (r Rect) MarshalJSON() ([]byte, error) {
+	return json.Marshal(rectJSON{X1: r.X1, Y1: r.Y1, X2: r.X2, Y2: r.Y2, Color: hexColor{r.Color}})
+}
+
+func (r *Rect) UnmarshalJSON(data []byte) error {
+	var v rectJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*r = Rect{X1: v.X1, Y1: v.Y1, X2: v.X2, Y2: v.Y2, Color: v.Color.or(DefaultRectColor)}
+	return nil
+}
+
+type figureJSON struct {
+	ID    string   `json:"id,omitempty"`
+	X     float64  `json:"x"`
+	Y     float64  `json:"y"`
+	Scale float64  `json:"scale"`
+	Color hexColor `json:"color"`
+}
+
+func (f Figure) MarshalJSON() ([]byte, error) {
+	scale := f.Scale
+	if scale == 0 {
+		scale = 1
+	}
+	return json.Marshal(figureJSON{ID: f.ID, X: f.X, Y: f.Y, Scale: scale, Color: hexColor{f.Color}})
+}
+
+func (f *Figure) UnmarshalJSON(data []byte) error {
+	var v figureJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*f = Figure{ID: v.ID, X: v.X, Y: v.Y, Scale: v.Scale, Color: v.Color.or(DefaultFigureColor)}
+	return nil
+}
+
+// hexColor кодує колір у JSON як рядок "#rrggbbaa" без попереднього множення на прозорість.
+type hexColor struct {
+	color.Color
+}
+
+func (c hexColor) or(def color.Color) color.Color {
+	if c.Color == nil {
+		return def
+	}
+	return c.Color
+}
+
+func (c hexColor) MarshalJSON() ([]byte, error) {
+	if c.Color == nil {
+		return []byte("null"), nil
+	}
+	n := color.NRGBAModel.Convert(c.Color).(color.NRGBA)
+	return json.Marshal(fmt.Sprintf("#%02x%02x%02x%02x", n.R, n.G, n.B, n.A))
+}
+
+func (c *hexColor) UnmarshalJSON(data []byte) error {
+	var str *string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	}
+	if str == nil {
+		c.Color = nil
+		return nil
+	}
+
+	hex := strings.TrimPrefix(*str, "#")
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || len(hex) != 8 || !strings.HasPrefix(*str, "#") {
+		return fmt.Errorf("invalid color %q, expected #rrggbbaa", *str)
+	}
+	c.Color = color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}
+	return nil
+}
+
+// SaveScene записує сцену у файл у форматі JSON. Запис відбувається через тимчасовий файл, тому при збої
+// попередній вміст файлу залишається неушкодженим.
+func SaveScene(path string, s *Scene) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(0o644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// LoadScene читає сцену, записану SaveScene.
+func LoadScene(path string) (*Scene, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := new(Scene)
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("cannot decode scene from %s: %w", path, err)
+	}
+	return s, nil
+}
@@ -0,0 +1,50 @@
+package painter
+
+import (
+	"encoding/json"
+	"image/color"
+	"testing"
+)
+
+func TestScene_JSON(t *testing.T) {
+	s := NewScene()
+	Fill(s, color.RGBA{G: 0xff, A: 0xff})
+	DrawBgRect(s, []float64{0.1, 0.2, 0.3, 0.4}, color.NRGBA{R: 0xff, A: 0x80})
+	DrawFigure(s, Figure{ID: "t1", X: 0.5, Y: 0.6, Scale: 2, Color: DefaultFigureColor})
+	DrawFigure(s, Figure{X: 0.7, Y: 0.8, Color: color.White})
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"background":"#00ff00ff",` +
+		`"rects":[{"x1":0.1,"y1":0.2,"x2":0.3,"y2":0.4,"color":"#ff000080"}],` +
+		`"figures":[{"id":"t1","x":0.5,"y":0.6,"scale":2,"color":"#ffff00ff"},{"x":0.7,"y":0.8,"scale":1,"color":"#ffffffff"}]}`
+	if string(data) != want {
+		t.Errorf("Unexpected JSON:\n%s\nexpected:\n%s", data, want)
+	}
+
+	var decoded Scene
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	again, _ := json.Marshal(&decoded)
+	if string(again) != want {
+		t.Errorf("Scene changed after decoding:\n%s", again)
+	}
+
+	empty, _ := json.Marshal(NewScene())
+	if string(empty) != `{"background":"#000000ff","rects":[],"figures":[]}` {
+		t.Errorf("Unexpected JSON for empty scene: %s", empty)
+	}
+
+	if err := json.Unmarshal([]byte(`{"figures":[{"x":0.5,"y":0.5}]}`), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Bgc != DefaultBgColor || decoded.Figures[0].Color != DefaultFigureColor {
+		t.Error("Missing colors were not replaced with defaults:", decoded)
+	}
+	if err := json.Unmarshal([]byte(`{"background":"green"}`), &decoded); err == nil {
+		t.Error("Invalid color was accepted")
+	}
+}
@@ -0,0 +1,283 @@
+package lang
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+)
+
+// Permission - набір дій, дозволених токену.
+type Permission uint8
+
+const (
+	PermRead  Permission = 1 << iota // Читання стану: /state, /frame.png, /events
+	PermDraw                         // Виконання команд
+	PermReset                        // Команди reset, load та save, які замінюють всю сцену або збережені сцени
+
+	PermAll = PermRead | PermDraw | PermReset
+)
+
+var permissionNames = []struct {
+	name string
+	perm Permission
+}{
+	{"read", PermRead},
+	{"draw", PermDraw},
+	{"reset", PermReset},
+}
+
+func (p Permission) String() string {
+	var names []string
+	for _, pn := range permissionNames {
+		if p&pn.perm != 0 {
+			names = append(names, pn.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// TokensEnv - змінна оточення, з якої cmd/painter читає токени, якщо файл токенів не вказано.
+const TokensEnv = "PAINTER_TOKENS"
+
+// TimestampHeader - заголовок з часом підпису (Unix-секунди) для запитів з HMAC-підписом.
+const TimestampHeader = "X-Painter-Timestamp"
+
+// Допустима різниця між часом підпису запиту та часом сервера.
+const maxClockSkew = 5 * time.Minute
+
+// Token описує клієнта, якому дозволено доступ до сервера.
+type Token struct {
+	Name   string // Ім'я клієнта, яке використовується в HMAC-підписі
+	Secret string
+	Perms  Permission
+}
+
+// ParseTokens читає токени у форматі name:secret:perm[,perm...], розділені пробілами або новими рядками.
+// Дозволи: read, draw, reset та all. Рядки, що починаються з #, ігноруються.
+func ParseTokens(in io.Reader) ([]Token, error) {
+	var (
+		res   []Token
+		names = make(map[string]bool)
+	)
+
+	scanner := bufio.NewScanner(in)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(text, "#") {
+			continue
+		}
+		for _, entry := range strings.Fields(text) {
+			tok, err := parseToken(entry)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			if names[tok.Name] {
+				return nil, fmt.Errorf("line %d: duplicate token name %q", line, tok.Name)
+			}
+			names[tok.Name] = true
+			res = append(res, tok)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func parseToken(entry string) (Token, error) {
+	parts := strings.Split(entry, ":")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+		return Token{}, fmt.Errorf("token must have the form name:secret:permissions")
+	}
+
+	tok := Token{Name: parts[0], Secret: parts[1]}
+	for _, name := range strings.Split(parts[2], ",") {
+		if name == "all" {
+			tok.Perms |= PermAll
+			continue
+		}
+		found := false
+		for _, pn := range permissionNames {
+			if pn.name == name {
+				tok.Perms |= pn.perm
+				found = true
+			}
+		}
+		if !found {
+			return Token{}, fmt.Errorf("unknown permission %q for token %q", name, tok.Name)
+		}
+	}
+	return tok, nil
+}
+
+// Auth перевіряє, що запити надіслані клієнтом з відомим токеном. Підтримуються два способи автентифікації:
+//
+//	Authorization: Bearer <secret>
+//	Authorization: HMAC <name>:<hex(HMAC-SHA256(secret, method + "\n" + uri + "\n" + timestamp + "\n" + body))>
+//
+// Для HMAC також потрібен заголовок X-Painter-Timestamp з часом підпису, щоб підписаний запит не можна було
+// повторити пізніше. Nil *Auth вимикає автентифікацію.
+type Auth struct {
+	tokens []Token
+	now    func() time.Time
+}
+
+// NewAuth створює Auth з переданим списком токенів.
+func NewAuth(tokens []Token) *Auth {
+	return &Auth{tokens: tokens, now: time.Now}
+}
+
+var errUnauthorized = errors.New("missing or invalid credentials")
+
+// Require конструює обробник, який пропускає до h лише запити з токеном, що має всі дозволи perm.
+// Токен запиту зберігається у його контексті, тому HttpHandler та WebSocketHandler додатково перевіряють
+// дозволи окремих команд (reset вимагає PermReset).
+func (a *Auth) Require(perm Permission, h http.Handler) http.Handler {
+	if a == nil {
+		return h
+	}
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		tok, err := a.authenticate(rw, r)
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeError(rw, http.StatusRequestEntityTooLarge, "too_large", "request body is larger than the allowed size")
+				return
+			}
+			rw.Header().Set("WWW-Authenticate", `Bearer realm="painter"`)
+			writeError(rw, http.StatusUnauthorized, "unauthorized", err.Error())
+			return
+		}
+		if tok.Perms&perm != perm {
+			writeError(rw, http.StatusForbidden, "forbidden", fmt.Sprintf("token %q lacks the %s permission", tok.Name, perm&^tok.Perms))
+			return
+		}
+		h.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), tokenKey{}, tok)))
+	})
+}
+
+func (a *Auth) authenticate(rw http.ResponseWriter, r *http.Request) (*Token, error) {
+	scheme, cred, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	cred = strings.TrimSpace(cred)
+
+	switch strings.ToLower(scheme) {
+	case "bearer":
+		var found *Token
+		for i := range a.tokens {
+			// Порівнюємо з усіма токенами, щоб час перевірки не залежав від того, який з них збігся.
+			if subtle.ConstantTimeCompare([]byte(a.tokens[i].Secret), []byte(cred)) == 1 {
+				found = &a.tokens[i]
+			}
+		}
+		if found == nil {
+			return nil, errUnauthorized
+		}
+		return found, nil
+
+	case "hmac":
+		name, sig, _ := strings.Cut(cred, ":")
+		var tok *Token
+		for i := range a.tokens {
+			if a.tokens[i].Name == name {
+				tok = &a.tokens[i]
+			}
+		}
+		mac, err := hex.DecodeString(sig)
+		if tok == nil || err != nil {
+			return nil, errUnauthorized
+		}
+
+		ts := r.Header.Get(TimestampHeader)
+		sec, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("missing or invalid %s header", TimestampHeader)
+		}
+		if d := a.now().Sub(time.Unix(sec, 0)); d > maxClockSkew || d < -maxClockSkew {
+			return nil, errors.New("request signature has expired")
+		}
+
+		// Тіло входить у підпис, тому його потрібно прочитати тут і повернути у запит для обробника.
+		body, err := io.ReadAll(http.MaxBytesReader(rw, r.Body, MaxScriptSize))
+		if err != nil {
+			return nil, err
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		if !hmac.Equal(mac, Sign(tok.Secret, r.Method, r.URL.RequestURI(), ts, body)) {
+			return nil, errUnauthorized
+		}
+		return tok, nil
+
+	default:
+		return nil, errUnauthorized
+	}
+}
+
+// Sign обчислює HMAC-підпис запиту, який перевіряє Auth.
+func Sign(secret, method, uri, timestamp string, body []byte) []byte {
+	m := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(m, "%s\n%s\n%s\n", method, uri, timestamp)
+	m.Write(body)
+	return m.Sum(nil)
+}
+
+type tokenKey struct{}
+
+// requestToken повертає токен, з яким автентифіковано запит, або nil, якщо автентифікацію вимкнено.
+func requestToken(ctx context.Context) *Token {
+	tok, _ := ctx.Value(tokenKey{}).(*Token)
+	return tok
+}
+
+// PermissionError повідомляє, що токен не має дозволу на виконання команди.
+type PermissionError struct {
+	Line    int // Номер рядка скрипта з командою, починаючи з 1
+	Command string
+	Perm    Permission // Дозвіл, якого бракує
+}
+
+func (e *PermissionError) Error() string {
+	return fmt.Sprintf("line %d: command %q requires the %s permission", e.Line, e.Command, e.Perm)
+}
+
+// commandPermissions - дозволи, які потрібні командам на додачу до PermDraw.
+var commandPermissions = map[string]Permission{
+	"reset": PermReset,
+	"load":  PermReset,
+	"save":  PermReset,
+}
+
+// authorize перевіряє, що токен tok може виконати всі команди ops. Nil токен дозволяє все.
+func authorize(tok *Token, ops []painter.Operation) error {
+	for _, op := range ops {
+		if err := authorizeCommand(tok, op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func authorizeCommand(tok *Token, op painter.Operation) error {
+	c, ok := op.(command)
+	if tok == nil || !ok {
+		return nil
+	}
+	name, _, _ := strings.Cut(c.text, " ")
+	if need := commandPermissions[name]; tok.Perms&need != need {
+		return &PermissionError{Line: c.line, Command: name, Perm: need &^ tok.Perms}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package lang
+
+import (
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+)
+
+func TestParseTokens(t *testing.T) {
+	tokens, err := ParseTokens(strings.NewReader("# dashboards\nviewer:s1:read\nbot:s2:read,draw admin:s3:all\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Token{
+		{Name: "viewer", Secret: "s1", Perms: PermRead},
+		{Name: "bot", Secret: "s2", Perms: PermRead | PermDraw},
+		{Name: "admin", Secret: "s3", Perms: PermAll},
+	}
+	if len(tokens) != len(want) {
+		t.Fatalf("Unexpected tokens %+v", tokens)
+	}
+	for i := range want {
+		if tokens[i] != want[i] {
+			t.Errorf("Token %d is %+v, expected %+v", i, tokens[i], want[i])
+		}
+	}
+
+	for _, bad := range []string{"viewer:s1", "viewer::read", "viewer:s1:write", "a:s1:read a:s2:read"} {
+		if _, err := ParseTokens(strings.NewReader(bad)); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+}
+
+func TestAuth(t *testing.T) {
+	var (
+		l painter.Loop
+		p Parser
+	)
+	auth := NewAuth([]Token{
+		{Name: "viewer", Secret: "s1", Perms: PermRead},
+		{Name: "bot", Secret: "s2", Perms: PermRead | PermDraw},
+		{Name: "admin", Secret: "s3", Perms: PermAll},
+	})
+	now := time.Unix(1700000000, 0)
+	auth.now = func() time.Time { return now }
+	h := auth.Require(PermDraw, HttpHandler(&l, &p))
+
+	bearer := func(secret, body string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+secret)
+		return r
+	}
+	signed := func(name, secret, body string, at time.Time) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/?wait=0", strings.NewReader(body))
+		ts := strconv.FormatInt(at.Unix(), 10)
+		r.Header.Set(TimestampHeader, ts)
+		r.Header.Set("Authorization", "HMAC "+name+":"+hex.EncodeToString(Sign(secret, r.Method, "/?wait=0", ts, []byte(body))))
+		return r
+	}
+
+	cases := []struct {
+		name   string
+		req    *http.Request
+		status int
+		code   string
+	}{
+		{"no credentials", httptest.NewRequest(http.MethodPost, "/", strings.NewReader("white")), http.StatusUnauthorized, "unauthorized"},
+		{"unknown token", bearer("nope", "white"), http.StatusUnauthorized, "unauthorized"},
+		{"read only", bearer("s1", "white"), http.StatusForbidden, "forbidden"},
+		{"draw", bearer("s2", "white\nupdate"), http.StatusAccepted, ""},
+		{"reset without permission", bearer("s2", "white\n\nreset"), http.StatusForbidden, "forbidden"},
+		{"reset", bearer("s3", "reset"), http.StatusAccepted, ""},
+		{"load without permission", bearer("s2", "load backup"), http.StatusForbidden, "forbidden"},
+		{"save without permission", bearer("s2", "save backup"), http.StatusForbidden, "forbidden"},
+		{"hmac", signed("bot", "s2", "green", now), http.StatusAccepted, ""},
+		{"hmac wrong secret", signed("bot", "s3", "green", now), http.StatusUnauthorized, "unauthorized"},
+		{"hmac expired", signed("bot", "s2", "green", now.Add(-time.Hour)), http.StatusUnauthorized, "unauthorized"},
+	}
+
+	for _, c := range cases {
+		rec, resp := serve(h, c.req)
+		if rec.Code != c.status {
+			t.Errorf("%s: status %d, expected %d (%s)", c.name, rec.Code, c.status, rec.Body)
+		}
+		if c.code != "" && (resp.Error == nil || resp.Error.Code != c.code) {
+			t.Errorf("%s: unexpected response %+v", c.name, resp)
+		}
+		if c.status == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: missing WWW-Authenticate header", c.name)
+		}
+	}
+
+	// Помилка дозволу вказує на рядок з командою.
+	_, resp := serve(h, bearer("s2", "white\n\nreset"))
+	if e := resp.Error; e == nil || e.Line != 3 || e.Token != "reset" {
+		t.Errorf("Unexpected permission error %+v", e)
+	}
+
+	// Підпис охоплює тіло, тому змінений запит відхиляється.
+	r := signed("bot", "s2", "green", now)
+	r.Body = http.NoBody
+	if rec, _ := serve(h, r); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Tampered request was accepted with status %d", rec.Code)
+	}
+
+	// Без Auth обробник доступний усім.
+	var none *Auth
+	if rec, _ := serve(none.Require(PermAll, HttpHandler(&l, &p)), httptest.NewRequest(http.MethodPost, "/", strings.NewReader("reset"))); rec.Code != http.StatusAccepted {
+		t.Errorf("Unexpected status %d without authentication", rec.Code)
+	}
+}
@@ -0,0 +1,88 @@
+package lang
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+)
+
+// Інтервал, з яким у потік подій надсилаються коментарі, щоб проксі не закривали неактивне з'єднання.
+const eventsKeepAlive = 15 * time.Second
+
+// FrameMessage - дані події frame у потоці EventsHandler.
+type FrameMessage struct {
+	Frame      uint64            `json:"frame"`
+	Time       time.Time         `json:"time"`
+	Operations []string          `json:"operations"` // Команди, виконані після попереднього кадру
+	Diff       painter.SceneDiff `json:"diff"`       // Зміни сцени відносно попереднього надісланого кадру
+}
+
+// EventsHandler конструює обробник потоку Server-Sent Events. На кожен кадр, відправлений циклом у Receiver,
+// клієнт отримує подію frame з FrameMessage у форматі JSON.
+func EventsHandler(loop *painter.Loop) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			rw.Header().Set("Allow", "GET")
+			writeError(rw, http.StatusMethodNotAllowed, "method_not_allowed", "method "+r.Method+" is not allowed")
+			return
+		}
+		flusher, ok := rw.(http.Flusher)
+		if !ok {
+			writeError(rw, http.StatusInternalServerError, "streaming_unsupported", "streaming is not supported")
+			return
+		}
+
+		events, cancel := loop.Subscribe(16)
+		defer cancel()
+
+		// Зміни рахуються відносно останнього надісланого клієнту кадру, тому пропущені події не спотворюють diff.
+		last, _ := loop.LastFrame()
+
+		rw.Header().Set("Content-Type", "text/event-stream")
+		rw.Header().Set("Cache-Control", "no-cache")
+		rw.WriteHeader(http.StatusOK)
+		fmt.Fprint(rw, ": connected\n\n")
+		flusher.Flush()
+
+		keepAlive := time.NewTicker(eventsKeepAlive)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case e, ok := <-events:
+				if !ok {
+					return
+				}
+				data, err := json.Marshal(FrameMessage{
+					Frame:      e.Frame,
+					Time:       e.Time,
+					Operations: append([]string{}, e.Ops...),
+					Diff:       painter.Diff(last, e.Scene),
+				})
+				if err != nil {
+					log.Printf("Cannot encode frame event: %s", err)
+					continue
+				}
+				last = e.Scene
+
+				if _, err := fmt.Fprintf(rw, "id: %d\nevent: frame\ndata: %s\n\n", e.Frame, data); err != nil {
+					return
+				}
+				flusher.Flush()
+
+			case <-keepAlive.C:
+				if _, err := fmt.Fprint(rw, ": ping\n\n"); err != nil {
+					return
+				}
+				flusher.Flush()
+
+			case <-r.Context().Done():
+				return
+			}
+		}
+	})
+}
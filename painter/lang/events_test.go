@@ -0,0 +1,96 @@
+package lang
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+	"github.com/roman-mazur/architecture-lab-3/ui/headless"
+)
+
+func TestEventsHandler(t *testing.T) {
+	var (
+		l  painter.Loop
+		p  Parser
+		fr frameRecorder
+	)
+	l.Receiver = &fr
+	l.Start(headless.Screen{})
+	defer l.StopAndWait()
+
+	srv := httptest.NewServer(EventsHandler(&l))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Unexpected content type %q", ct)
+	}
+
+	events := bufio.NewScanner(resp.Body)
+	readEvent := func() (fields map[string]string) {
+		fields = make(map[string]string)
+		for events.Scan() {
+			line := events.Text()
+			if line == "" {
+				if len(fields) > 0 {
+					return
+				}
+				continue
+			}
+			if strings.HasPrefix(line, ":") {
+				continue
+			}
+			name, value, _ := strings.Cut(line, ": ")
+			fields[name] = value
+		}
+		t.Fatal("Stream ended:", events.Err())
+		return
+	}
+
+	// Підписка відбувається до надсилання заголовків, тому після їх отримання жоден кадр не буде пропущено.
+	for _, script := range []string{"green\nfigure t1 0.5 0.5\nupdate", "move t1 0.2 0.3\nupdate"} {
+		ops, err := p.Parse(strings.NewReader(script))
+		if err != nil {
+			t.Fatal(err)
+		}
+		l.Post(painter.OperationList(ops))
+	}
+
+	wants := []struct {
+		id   string
+		ops  []string
+		diff string
+	}{
+		{"1", []string{"green", "figure t1 0.5 0.5", "update"}, `{"background":"#00ff00ff","figures_added":[{"id":"t1","x":0.5,"y":0.5,"scale":1,"color":"#ffff00ff"}]}`},
+		{"2", []string{"move t1 0.2 0.3", "update"}, `{"figures_changed":[{"id":"t1","x":0.2,"y":0.3,"scale":1,"color":"#ffff00ff"}]}`},
+	}
+	for _, want := range wants {
+		e := readEvent()
+		if e["event"] != "frame" || e["id"] != want.id {
+			t.Errorf("Unexpected event %v", e)
+		}
+
+		var msg struct {
+			Frame      uint64
+			Operations []string
+			Diff       json.RawMessage
+		}
+		if err := json.Unmarshal([]byte(e["data"]), &msg); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(msg.Operations, "|") != strings.Join(want.ops, "|") {
+			t.Errorf("Frame %s: unexpected operations %q", want.id, msg.Operations)
+		}
+		if string(msg.Diff) != want.diff {
+			t.Errorf("Frame %s: unexpected diff %s", want.id, msg.Diff)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package lang
+
+import (
+	"image"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+	"github.com/roman-mazur/architecture-lab-3/ui/headless"
+)
+
+// FrameHandler конструює обробник, який повертає останній кадр, відправлений циклом у Receiver, як зображення PNG
+// (або JPEG з параметром ?format=jpeg). Кадр не читається з текстури, а заново малюється з копії сцени.
+func FrameHandler(loop *painter.Loop) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			rw.Header().Set("Allow", "GET, HEAD")
+			writeError(rw, http.StatusMethodNotAllowed, "method_not_allowed", "method "+r.Method+" is not allowed")
+			return
+		}
+
+		format := r.URL.Query().Get("format")
+		if format != "" && format != "png" && format != "jpeg" && format != "jpg" {
+			writeError(rw, http.StatusBadRequest, "bad_format", "unsupported image format "+format)
+			return
+		}
+
+		scene, frame := loop.LastFrame()
+		if scene == nil {
+			writeError(rw, http.StatusNotFound, "no_frame", "no frame has been rendered yet")
+			return
+		}
+		img := renderScene(scene, loop.Size)
+
+		rw.Header().Set("Cache-Control", "no-store")
+		rw.Header().Set("X-Painter-Frame", strconv.FormatUint(frame, 10))
+
+		var err error
+		if format == "jpeg" || format == "jpg" {
+			rw.Header().Set("Content-Type", "image/jpeg")
+			err = jpeg.Encode(rw, img, &jpeg.Options{Quality: 90})
+		} else {
+			rw.Header().Set("Content-Type", "image/png")
+			err = png.Encode(rw, img)
+		}
+		if err != nil {
+			log.Printf("Cannot write frame: %s", err)
+		}
+	})
+}
+
+func renderScene(s *painter.Scene, size image.Point) image.Image {
+	if size.X <= 0 || size.Y <= 0 {
+		size = painter.DefaultSize
+	}
+	t := headless.NewTexture(size)
+	painter.CreateTexture(t, s)
+	return t.RGBA()
+}
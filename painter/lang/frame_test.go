@@ -0,0 +1,75 @@
+package lang
+
+import (
+	"context"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+	"github.com/roman-mazur/architecture-lab-3/ui/headless"
+)
+
+func TestFrameHandler(t *testing.T) {
+	var (
+		l  painter.Loop
+		p  Parser
+		fr frameRecorder
+	)
+	l.Receiver = &fr
+	l.Size = image.Pt(200, 100)
+	l.Start(headless.Screen{})
+	defer l.StopAndWait()
+	h := FrameHandler(&l)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/frame.png", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Unexpected status %d before the first frame", rec.Code)
+	}
+
+	ops, err := p.Parse(strings.NewReader("fill navy\nbgrect 0.1 0.1 0.5 0.5 red\nfigure 0.6 0.6\nupdate\nwhite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Exec(context.Background(), painter.OperationList(ops)); err != nil {
+		t.Fatal(err)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/frame.png", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("Unexpected response %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if frame := rec.Header().Get("X-Painter-Frame"); frame != "1" {
+		t.Errorf("Unexpected frame number %q", frame)
+	}
+	img, err := png.Decode(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Кадр відображає стан після виконання всього списку операцій, тому зображення має збігатися з текстурою,
+	// отриманою Receiver.
+	if err := compareImages(fr.last, img); err != nil {
+		t.Error("Frame differs from the texture sent to the receiver:", err)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/frame.png?format=jpeg", nil))
+	if rec.Header().Get("Content-Type") != "image/jpeg" {
+		t.Errorf("Unexpected content type %q", rec.Header().Get("Content-Type"))
+	}
+	if _, err := jpeg.Decode(rec.Body); err != nil {
+		t.Error("Cannot decode jpeg frame:", err)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/frame.png?format=gif", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Unexpected status %d for unsupported format", rec.Code)
+	}
+}
@@ -0,0 +1,135 @@
+package lang
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/exp/shiny/screen"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+	"github.com/roman-mazur/architecture-lab-3/ui/headless"
+)
+
+var updateGolden = flag.Bool("update", false, "regenerate golden images in testdata/golden")
+
+// TestGolden виконує кожен скрипт з testdata через Parser та painter.Loop і порівнює останній відображений кадр
+// з еталонним зображенням testdata/golden/<скрипт>.png.
+func TestGolden(t *testing.T) {
+	scripts, err := filepath.Glob(filepath.Join("testdata", "*.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scripts) == 0 {
+		t.Fatal("No scripts found in testdata")
+	}
+
+	for _, script := range scripts {
+		name := strings.TrimSuffix(filepath.Base(script), ".txt")
+		t.Run(name, func(t *testing.T) {
+			frame := renderScript(t, script)
+			golden := filepath.Join("testdata", "golden", name+".png")
+
+			if *updateGolden {
+				if err := headless.WritePNG(golden, frame); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			want, err := readPNG(golden)
+			if err != nil {
+				t.Fatalf("Cannot read golden image (run with -update to create it): %s", err)
+			}
+			if err := compareImages(want, frame); err != nil {
+				actual := filepath.Join(t.TempDir(), name+".png")
+				_ = headless.WritePNG(actual, frame)
+				t.Errorf("Frame differs from %s: %s (actual frame saved to %s)", golden, err, actual)
+			}
+		})
+	}
+}
+
+func renderScript(t *testing.T, path string) image.Image {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var p Parser
+	ops, err := p.Parse(f)
+	if err != nil {
+		t.Fatalf("Cannot parse %s: %s", path, err)
+	}
+
+	var (
+		l  painter.Loop
+		fr frameRecorder
+	)
+	l.Receiver = &fr
+	l.Start(headless.Screen{})
+	l.Post(painter.OperationList(ops))
+	l.StopAndWait()
+
+	if fr.last == nil {
+		t.Fatalf("Script %s did not produce any frame", path)
+	}
+	return fr.last
+}
+
+// frameRecorder копіює кожну отриману текстуру, оскільки Loop повторно використовує текстури для наступних кадрів.
+type frameRecorder struct {
+	last *image.RGBA
+}
+
+func (fr *frameRecorder) Update(t screen.Texture) {
+	src := t.(*headless.Texture).RGBA()
+	fr.last = &image.RGBA{
+		Pix:    append([]byte(nil), src.Pix...),
+		Stride: src.Stride,
+		Rect:   src.Rect,
+	}
+}
+
+func readPNG(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return png.Decode(f)
+}
+
+func compareImages(want, got image.Image) error {
+	if want.Bounds() != got.Bounds() {
+		return fmt.Errorf("bounds %v, expected %v", got.Bounds(), want.Bounds())
+	}
+
+	var (
+		diff  int
+		first image.Point
+	)
+	b := want.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			wr, wg, wb, wa := want.At(x, y).RGBA()
+			gr, gg, gb, ga := got.At(x, y).RGBA()
+			if wr != gr || wg != gg || wb != gb || wa != ga {
+				if diff == 0 {
+					first = image.Pt(x, y)
+				}
+				diff++
+			}
+		}
+	}
+	if diff > 0 {
+		return fmt.Errorf("%d pixels differ, first at %v", diff, first)
+	}
+	return nil
+}
@@ -1,31 +1,222 @@
 package lang
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
+	"mime"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/roman-mazur/architecture-lab-3/painter"
 )
 
+const (
+	// MaxScriptSize - максимальний розмір тіла запиту зі скриптом у байтах.
+	MaxScriptSize = 1 << 20
+	// MaxWait - максимальний час очікування виконання скрипта у синхронному режимі.
+	MaxWait = 30 * time.Second
+)
+
+// WaitHeader - заголовок, яким, як і параметром ?wait=1, можна увімкнути синхронний режим.
+const WaitHeader = "X-Painter-Wait"
+
+// Типи вмісту, в яких може надходити скрипт. Форма приймається, бо саме її надсилає curl -d.
+var scriptContentTypes = map[string]bool{
+	"text/plain":                        true,
+	"application/x-www-form-urlencoded": true,
+	"application/octet-stream":          true,
+}
+
 // HttpHandler конструює обробник HTTP запитів, який дані з запиту віддає у Parser, а потім відправляє отриманий список
-// операцій у painter.Loop.
+// операцій у painter.Loop. Відповідь завжди має формат JSON (див. Response).
+//
+// За замовчуванням обробник відповідає 202 Accepted одразу після додавання операцій у чергу. У синхронному режимі
+// (?wait=1 або заголовок X-Painter-Wait: 1) відповідь надсилається лише після виконання операцій і містить ExecResult.
+// Якщо команда save або load не виконалася, у синхронному режимі замість результату повертається її помилка.
 func HttpHandler(loop *painter.Loop, p *Parser) http.Handler {
 	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
-		var in io.Reader = r.Body
-		if r.Method == http.MethodGet {
+		var in io.Reader
+		switch r.Method {
+		case http.MethodGet:
 			in = strings.NewReader(r.URL.Query().Get("cmd"))
+		case http.MethodPost:
+			if ct := r.Header.Get("Content-Type"); ct != "" {
+				mt, _, err := mime.ParseMediaType(ct)
+				if err != nil || !scriptContentTypes[mt] {
+					writeError(rw, http.StatusUnsupportedMediaType, "unsupported_media_type", "unsupported content type "+ct)
+					return
+				}
+			}
+			body, err := io.ReadAll(http.MaxBytesReader(rw, r.Body, MaxScriptSize))
+			if err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					writeError(rw, http.StatusRequestEntityTooLarge, "too_large", "script is larger than the allowed size")
+				} else {
+					writeError(rw, http.StatusBadRequest, "bad_request", err.Error())
+				}
+				return
+			}
+			in = bytes.NewReader(body)
+		default:
+			rw.Header().Set("Allow", "GET, POST")
+			writeError(rw, http.StatusMethodNotAllowed, "method_not_allowed", "method "+r.Method+" is not allowed")
+			return
 		}
 
 		cmds, err := p.Parse(in)
 		if err != nil {
 			log.Printf("Bad script: %s", err)
-			rw.WriteHeader(http.StatusBadRequest)
+			writeParseError(rw, err)
+			return
+		}
+		if err := authorize(requestToken(r.Context()), cmds); err != nil {
+			writeJSON(rw, http.StatusForbidden, Response{Error: responseError(err)})
+			return
+		}
+
+		if !waitRequested(r) {
+			// Клієнт, що відключився, не повинен тримати обробник, поки він чекає на місце у заповненій черзі.
+			if err := loop.PostContext(r.Context(), painter.OperationList(cmds)); err != nil {
+				writeExecError(rw, err)
+				return
+			}
+			writeJSON(rw, http.StatusAccepted, Response{OK: true, Result: ScriptResult{Operations: len(cmds)}})
 			return
 		}
 
-		loop.Post(painter.OperationList(cmds))
-		rw.WriteHeader(http.StatusOK)
+		ctx, cancel := context.WithTimeout(r.Context(), MaxWait)
+		defer cancel()
+		res, err := loop.Exec(ctx, painter.OperationList(cmds))
+		if err != nil {
+			writeExecError(rw, err)
+			return
+		}
+		if op, line := failedSnapshot(cmds); op != nil {
+			writeSnapshotError(rw, op, line)
+			return
+		}
+		writeJSON(rw, http.StatusOK, Response{OK: true, Result: ExecResult{
+			Operations: len(cmds),
+			Updated:    res.Updated,
+			Frame:      res.Frame,
+		}})
 	})
 }
+
+// Response - конверт, у якому обробники повертають результат або помилку.
+type Response struct {
+	OK     bool           `json:"ok"`
+	Result any            `json:"result,omitempty"`
+	Error  *ResponseError `json:"error,omitempty"`
+}
+
+// ResponseError описує помилку запиту. Для помилок розбору скрипта заповнюються поля з ParseError.
+type ResponseError struct {
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Token    string `json:"token,omitempty"`
+	Expected string `json:"expected,omitempty"`
+}
+
+// ScriptResult - результат прийнятого до виконання скрипта.
+type ScriptResult struct {
+	Operations int `json:"operations"`
+}
+
+// ExecResult - результат скрипта, виконаного у синхронному режимі.
+type ExecResult struct {
+	Operations int    `json:"operations"`
+	Updated    bool   `json:"updated"` // Чи був відображений новий кадр
+	Frame      uint64 `json:"frame"`   // Номер останнього відображеного кадру
+}
+
+func waitRequested(r *http.Request) bool {
+	for _, v := range []string{r.URL.Query().Get("wait"), r.Header.Get(WaitHeader)} {
+		if ok, _ := strconv.ParseBool(v); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// writeJSON кодує відповідь ще до запису статусу, тому помилка кодування повертається як 500 encode_failed,
+// а не як успішна відповідь з порожнім тілом.
+func writeJSON(rw http.ResponseWriter, status int, resp Response) {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		log.Printf("Cannot encode response: %s", err)
+		status = http.StatusInternalServerError
+		data, _ = json.Marshal(Response{Error: &ResponseError{Code: "encode_failed", Message: err.Error()}})
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	if _, err := rw.Write(append(data, '\n')); err != nil {
+		log.Printf("Cannot write response: %s", err)
+	}
+}
+
+func writeError(rw http.ResponseWriter, status int, code, msg string) {
+	writeJSON(rw, status, Response{Error: &ResponseError{Code: code, Message: msg}})
+}
+
+// writeExecError повідомляє, чому операції не були виконані: черга заповнена, цикл зупиняється, операцію
+// відкинуто з черги, не вистачило часу на очікування, або операція виконалася, але завершилася панікою.
+func writeExecError(rw http.ResponseWriter, err error) {
+	var opErr *painter.OperationError
+	switch {
+	case errors.Is(err, painter.ErrQueueFull):
+		rw.Header().Set("Retry-After", "1")
+		writeError(rw, http.StatusTooManyRequests, "queue_full", "operation queue is full")
+	case errors.Is(err, painter.ErrStopped):
+		writeError(rw, http.StatusServiceUnavailable, "stopped", "painter is shutting down")
+	case errors.Is(err, painter.ErrDropped):
+		writeError(rw, http.StatusServiceUnavailable, "dropped", "operations were dropped from the full queue")
+	case errors.As(err, &opErr):
+		writeError(rw, http.StatusInternalServerError, "operation_failed", opErr.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		writeError(rw, http.StatusGatewayTimeout, "timeout", "operations were not executed in time")
+	default:
+		writeError(rw, http.StatusInternalServerError, "exec_failed", err.Error())
+	}
+}
+
+func writeParseError(rw http.ResponseWriter, err error) {
+	writeJSON(rw, http.StatusBadRequest, Response{Error: responseError(err)})
+}
+
+// responseError описує помилку розбору скрипта. Для ParseError заповнюються поля з місцем помилки,
+// PermissionError повертається з кодом forbidden, а помилки черги - з кодами queue_full та stopped.
+func responseError(err error) *ResponseError {
+	re := &ResponseError{Code: "bad_script", Message: err.Error()}
+
+	var (
+		pe   *ParseError
+		perr *PermissionError
+	)
+	switch {
+	case errors.As(err, &pe):
+		re.Message = pe.Err.Error()
+		re.Line, re.Column = pe.Line, pe.Column
+		re.Token, re.Expected = pe.Token, pe.Expected
+	case errors.As(err, &perr):
+		re.Code = "forbidden"
+		re.Message = fmt.Sprintf("command %q requires the %s permission", perr.Command, perr.Perm)
+		re.Line, re.Token = perr.Line, perr.Command
+	case errors.Is(err, painter.ErrQueueFull):
+		re.Code = "queue_full"
+	case errors.Is(err, painter.ErrStopped):
+		re.Code = "stopped"
+	}
+	return re
+}
@@ -0,0 +1,202 @@
+package lang
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+	"github.com/roman-mazur/architecture-lab-3/ui/headless"
+)
+
+func serve(h http.Handler, r *http.Request) (*httptest.ResponseRecorder, Response) {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+
+	var resp Response
+	_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+	return rec, resp
+}
+
+func TestHttpHandler(t *testing.T) {
+	var (
+		l painter.Loop
+		p Parser
+	)
+	h := HttpHandler(&l, &p)
+
+	post := func(body, contentType string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		if contentType != "" {
+			r.Header.Set("Content-Type", contentType)
+		}
+		return r
+	}
+
+	cases := []struct {
+		name   string
+		req    *http.Request
+		status int
+		code   string
+	}{
+		{"post", post("white\nupdate", ""), http.StatusAccepted, ""},
+		{"curl form", post("white", "application/x-www-form-urlencoded"), http.StatusAccepted, ""},
+		{"text", post("white", "text/plain; charset=utf-8"), http.StatusAccepted, ""},
+		{"get", httptest.NewRequest(http.MethodGet, "/?cmd=green", nil), http.StatusAccepted, ""},
+		{"bad script", post("white\nbgrect 0.1 0.1", ""), http.StatusBadRequest, "bad_script"},
+		{"method", httptest.NewRequest(http.MethodDelete, "/", nil), http.StatusMethodNotAllowed, "method_not_allowed"},
+		{"too large", post(strings.Repeat("white\n", MaxScriptSize/6+1), ""), http.StatusRequestEntityTooLarge, "too_large"},
+		{"content type", post("{}", "application/json"), http.StatusUnsupportedMediaType, "unsupported_media_type"},
+	}
+
+	for _, c := range cases {
+		rec, resp := serve(h, c.req)
+		if rec.Code != c.status {
+			t.Errorf("%s: status %d, expected %d", c.name, rec.Code, c.status)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s: unexpected content type %q", c.name, ct)
+		}
+		if resp.OK != (c.code == "") {
+			t.Errorf("%s: unexpected ok flag in %s", c.name, rec.Body)
+		}
+		if c.code != "" && (resp.Error == nil || resp.Error.Code != c.code) {
+			t.Errorf("%s: unexpected error in %s", c.name, rec.Body)
+		}
+	}
+}
+
+func TestHttpHandler_ParseError(t *testing.T) {
+	var (
+		l painter.Loop
+		p Parser
+	)
+	h := HttpHandler(&l, &p)
+
+	_, resp := serve(h, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("white\nbgrect 0.1 0.1")))
+	want := ResponseError{
+		Code:     "bad_script",
+		Message:  incorrectParamsNum.Error(),
+		Line:     2,
+		Column:   1,
+		Token:    "bgrect",
+		Expected: "bgrect x1 y1 x2 y2 [color]",
+	}
+	if resp.Error == nil || *resp.Error != want {
+		t.Errorf("Unexpected error %+v, expected %+v", resp.Error, want)
+	}
+}
+
+func TestHttpHandler_Wait(t *testing.T) {
+	var (
+		l  painter.Loop
+		p  Parser
+		fr frameRecorder
+	)
+	l.Receiver = &fr
+	l.Start(headless.Screen{})
+	defer l.StopAndWait()
+	h := HttpHandler(&l, &p)
+
+	for i, c := range []struct {
+		req     *http.Request
+		updated bool
+		frame   uint64
+	}{
+		{httptest.NewRequest(http.MethodPost, "/?wait=1", strings.NewReader("green\nupdate")), true, 1},
+		{httptest.NewRequest(http.MethodGet, "/?wait=true&cmd=white", nil), false, 1},
+		{httptest.NewRequest(http.MethodPost, "/", strings.NewReader("update")), true, 2},
+	} {
+		if i == 2 {
+			c.req.Header.Set(WaitHeader, "1")
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, c.req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("Request %d: unexpected status %d", i, rec.Code)
+		}
+
+		var resp struct {
+			Result ExecResult
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Result.Updated != c.updated || resp.Result.Frame != c.frame {
+			t.Errorf("Request %d: unexpected result %+v", i, resp.Result)
+		}
+	}
+}
+
+func TestHttpHandler_QueueFull(t *testing.T) {
+	var p Parser
+	l := painter.Loop{QueueCap: 1, QueuePolicy: painter.QueueReject}
+	l.Receiver = &frameRecorder{}
+	l.Start(headless.Screen{})
+	defer l.StopAndWait()
+
+	// Поки цикл виконує операцію, що чекає на blocked, у черзі поміщається лише один скрипт.
+	started, blocked := make(chan struct{}), make(chan struct{})
+	l.Post(painter.OperationFunc(func(*painter.Scene) {
+		close(started)
+		<-blocked
+	}))
+	<-started
+	defer close(blocked)
+
+	h := HttpHandler(&l, &p)
+	if rec, _ := serve(h, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("white"))); rec.Code != http.StatusAccepted {
+		t.Fatalf("Unexpected status %d", rec.Code)
+	}
+	for _, target := range []string{"/", "/?wait=1"} {
+		rec, resp := serve(h, httptest.NewRequest(http.MethodPost, target, strings.NewReader("green")))
+		if rec.Code != http.StatusTooManyRequests || resp.Error == nil || resp.Error.Code != "queue_full" {
+			t.Errorf("%s: unexpected response %d %+v", target, rec.Code, resp)
+		}
+		if rec.Header().Get("Retry-After") == "" {
+			t.Errorf("%s: missing Retry-After header", target)
+		}
+	}
+}
+
+func TestWriteExecError(t *testing.T) {
+	cases := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{painter.ErrQueueFull, http.StatusTooManyRequests, "queue_full"},
+		{painter.ErrStopped, http.StatusServiceUnavailable, "stopped"},
+		{painter.ErrDropped, http.StatusServiceUnavailable, "dropped"},
+		{&painter.OperationError{Op: "white", Panic: "boom"}, http.StatusInternalServerError, "operation_failed"},
+		{context.DeadlineExceeded, http.StatusGatewayTimeout, "timeout"},
+		{context.Canceled, http.StatusInternalServerError, "exec_failed"},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		writeExecError(rec, c.err)
+
+		var resp Response
+		_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+		if rec.Code != c.status || resp.Error == nil || resp.Error.Code != c.code {
+			t.Errorf("%v: unexpected response %d %s", c.err, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestWriteJSON_EncodeError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeJSON(rec, http.StatusOK, Response{OK: true, Result: math.NaN()})
+
+	var resp Response
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Response is not JSON: %s (%q)", err, rec.Body)
+	}
+	if rec.Code != http.StatusInternalServerError || resp.OK || resp.Error == nil || resp.Error.Code != "encode_failed" {
+		t.Errorf("Unexpected response %d %s", rec.Code, rec.Body)
+	}
+}
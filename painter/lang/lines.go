@@ -0,0 +1,138 @@
+package lang
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+)
+
+// LineServer обслуговує потокові з'єднання (TCP, Unix socket), у яких команди надходять по одній на рядок.
+// На кожен рядок сервер відповідає одним рядком: "OK" або "ERR <повідомлення>". Команди розбираються тим самим
+// Parser і потрапляють у той самий painter.Loop, що і команди з HttpHandler. Автентифікація не підтримується,
+// тому cmd/painter не дозволяє запускати LineServer разом з токенами доступу.
+type LineServer struct {
+	Loop   *painter.Loop
+	Parser *Parser
+
+	mu        sync.Mutex
+	closed    bool
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	wg        sync.WaitGroup
+}
+
+// ErrServerClosed повертається з Serve після виклику Close.
+var ErrServerClosed = errors.New("lang: line server closed")
+
+// Serve приймає з'єднання з ln, доки не буде викликано Close або не виникне помилка.
+func (s *LineServer) Serve(ln net.Listener) error {
+	if !s.track(ln, nil) {
+		ln.Close()
+		return ErrServerClosed
+	}
+	defer s.untrack(ln, nil)
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			return err
+		}
+		if !s.track(nil, conn) {
+			conn.Close()
+			return ErrServerClosed
+		}
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer s.untrack(nil, conn)
+			s.serveConn(conn)
+		}()
+	}
+}
+
+// Close закриває всі слухачі та активні з'єднання і чекає завершення їх обробки.
+func (s *LineServer) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	var err error
+	for ln := range s.listeners {
+		if cerr := ln.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+func (s *LineServer) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	le := lineExecutor{loop: s.Loop, parser: s.Parser}
+	in := bufio.NewScanner(conn)
+	out := bufio.NewWriter(conn)
+
+	for in.Scan() {
+		if err := le.exec(in.Text()); err != nil {
+			fmt.Fprintf(out, "ERR %s\n", err)
+		} else {
+			fmt.Fprint(out, "OK\n")
+		}
+		if err := out.Flush(); err != nil {
+			return
+		}
+	}
+	if err := in.Err(); err != nil && !s.isClosed() {
+		log.Printf("Line connection %s failed: %s", conn.RemoteAddr(), err)
+	}
+}
+
+func (s *LineServer) track(ln net.Listener, conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+	if ln != nil {
+		if s.listeners == nil {
+			s.listeners = make(map[net.Listener]struct{})
+		}
+		s.listeners[ln] = struct{}{}
+	}
+	if conn != nil {
+		if s.conns == nil {
+			s.conns = make(map[net.Conn]struct{})
+		}
+		s.conns[conn] = struct{}{}
+	}
+	return true
+}
+
+func (s *LineServer) untrack(ln net.Listener, conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.listeners, ln)
+	delete(s.conns, conn)
+}
+
+func (s *LineServer) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.closed
+}
@@ -0,0 +1,92 @@
+package lang
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+	"github.com/roman-mazur/architecture-lab-3/ui/headless"
+)
+
+func TestLineServer(t *testing.T) {
+	t.Run("tcp", func(t *testing.T) {
+		testLineServer(t, "tcp", "127.0.0.1:0")
+	})
+	t.Run("unix", func(t *testing.T) {
+		testLineServer(t, "unix", filepath.Join(t.TempDir(), "painter.sock"))
+	})
+}
+
+func testLineServer(t *testing.T, network, addr string) {
+	var (
+		l  painter.Loop
+		p  Parser
+		fr frameRecorder
+	)
+	l.Receiver = &fr
+	l.Start(headless.Screen{})
+	defer l.StopAndWait()
+
+	ln, err := net.Listen(network, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := LineServer{Loop: &l, Parser: &p}
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.Serve(ln)
+	}()
+
+	conn, err := net.Dial(network, ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := fmt.Fprint(conn, "green\nfigure t1 0.5 0.5\nbogus 1\n\nmove t1 0.2 0.2\r\nupdate\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"OK",
+		"OK",
+		`ERR line 3, column 1: no such operation at "bogus"`,
+		"OK",
+		"OK",
+		"OK",
+	}
+	in := bufio.NewScanner(conn)
+	for _, w := range want {
+		if !in.Scan() {
+			t.Fatal("Connection closed early:", in.Err())
+		}
+		if got := in.Text(); got != w {
+			t.Errorf("Unexpected reply %q, expected %q", got, w)
+		}
+	}
+
+	if _, err := l.Exec(context.Background(), painter.UpdateOp); err != nil {
+		t.Fatal(err)
+	}
+	if f := l.Scene().Figures; len(f) != 1 || f[0].X != 0.2 {
+		t.Error("Commands were not applied:", f)
+	}
+
+	if err := srv.Close(); err != nil {
+		t.Error(err)
+	}
+	if err := <-served; !errors.Is(err, ErrServerClosed) {
+		t.Error("Unexpected Serve result:", err)
+	}
+	// Після Close з'єднання клієнта закривається сервером.
+	if in.Scan() {
+		t.Errorf("Unexpected reply after Close: %q", in.Text())
+	}
+}
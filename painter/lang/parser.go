@@ -3,10 +3,13 @@ package lang
 import (
 	"bufio"
 	"fmt"
-	"golang.org/x/exp/shiny/screen"
+	"image/color"
 	"io"
+	"math"
+	"path"
 	"strconv"
 	"strings"
+	"unicode"
 
 	"github.com/roman-mazur/architecture-lab-3/painter"
 )
@@ -16,46 +19,114 @@ type commandType int
 const (
 	white commandType = iota
 	green
+	fill
 	update
 	bgrect
 	figure
 	move
+	translate
 	reset
+	save
+	load
 )
 
 var commandStrings = map[string]commandType{
-	"white":  white,
-	"green":  green,
-	"update": update,
-	"bgrect": bgrect,
-	"figure": figure,
-	"move":   move,
-	"reset":  reset,
+	"white":     white,
+	"green":     green,
+	"fill":      fill,
+	"update":    update,
+	"bgrect":    bgrect,
+	"figure":    figure,
+	"move":      move,
+	"translate": translate,
+	"reset":     reset,
+	"save":      save,
+	"load":      load,
 }
 
-var incorrectParamsNum = fmt.Errorf("incorrect number of parameters for provided operation")
+// Очікувані параметри кожної команди, які повертаються у ParseError.
+var commandUsage = map[commandType]string{
+	white:     "white",
+	green:     "green",
+	fill:      "fill <color>",
+	update:    "update",
+	bgrect:    "bgrect x1 y1 x2 y2 [color]",
+	figure:    "figure [id] x y [scale] [color]",
+	move:      "move [selector] x y",
+	translate: "translate [selector] dx dy",
+	reset:     "reset",
+	save:      "save <name>",
+	load:      "load <name>",
+}
+
+var (
+	incorrectParamsNum = fmt.Errorf("incorrect number of parameters for provided operation")
+	noSuchOperation    = fmt.Errorf("no such operation")
+)
+
+// ParseError описує помилку в скрипті та місце, де вона виникла.
+type ParseError struct {
+	Line     int    // Номер рядка скрипта, починаючи з 1
+	Column   int    // Номер символу в рядку, з якого починається помилковий токен, починаючи з 1
+	Token    string // Помилковий токен
+	Expected string // Очікувані параметри команди, наприклад "move [selector] x y"
+	Err      error
+}
+
+func (e *ParseError) Error() string {
+	var sb strings.Builder
+	if e.Line > 0 {
+		fmt.Fprintf(&sb, "line %d, ", e.Line)
+	}
+	fmt.Fprintf(&sb, "column %d: %s", e.Column, e.Err)
+	if e.Token != "" {
+		fmt.Fprintf(&sb, " at %q", e.Token)
+	}
+	if e.Expected != "" {
+		fmt.Fprintf(&sb, " (expected %q)", e.Expected)
+	}
+	return sb.String()
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
 
 type Parser struct {
+	// StateDir - каталог, у якому команди save та load зберігають сцени. Якщо не вказано, використовується
+	// поточний каталог.
+	StateDir string
 }
 
+// Parse розбирає скрипт з in, по одній команді в рядку. Помилки в командах повертаються як *ParseError.
 func (p *Parser) Parse(in io.Reader) ([]painter.Operation, error) {
 	scanner := bufio.NewScanner(in)
 	scanner.Split(bufio.ScanLines)
 
-	var res []painter.Operation
+	var (
+		res  []painter.Operation
+		line int
+	)
 
 	for scanner.Scan() {
+		line++
 		commandLine := scanner.Text()
 
-		op, err := parseCommand(commandLine)
+		op, err := p.parseCommand(commandLine)
 		if err != nil {
+			if pe, ok := err.(*ParseError); ok {
+				pe.Line = line
+			}
 			return nil, err
 		}
 
 		if op != nil {
-			res = append(res, op)
+			res = append(res, withLine(op, line))
 		}
 	}
+	if err := scanner.Err(); err != nil {
+		return nil, &ParseError{Line: line + 1, Column: 1, Err: err}
+	}
 	if len(res) == 0 {
 		return nil, fmt.Errorf("empty operation")
 	}
@@ -63,8 +134,61 @@ func (p *Parser) Parse(in io.Reader) ([]painter.Operation, error) {
 	return res, nil
 }
 
-func parseCommand(cl string) (painter.Operation, error) {
+// parseCommand розбирає один рядок скрипта. Помилки повертаються як *ParseError без номера рядка.
+// Операція описується текстом команди, який потрапляє у події про кадри (див. painter.FrameEvent).
+func (p *Parser) parseCommand(cl string) (painter.Operation, error) {
+	op, err := p.parseOperation(cl)
+	if op == nil || err != nil {
+		return op, err
+	}
 	parts := strings.Fields(cl)
+	return command{Operation: op, text: strings.Join(parts, " "), key: coalesceKey(parts)}, nil
+}
+
+// coalesceKey визначає ключ, за яким команду можна злити з іншими у черзі циклу (див. painter.Coalescable).
+// Ключ мають лише команди, які повністю перезаписують частину стану сцени.
+func coalesceKey(parts []string) string {
+	switch commandStrings[parts[0]] {
+	case white, green, fill:
+		return "fill"
+	case update:
+		return painter.UpdateKey
+	case move:
+		if selector, _ := splitTarget(parts[1:]); selector != "" {
+			return "move " + selector
+		}
+		return "move *"
+	}
+	return ""
+}
+
+// command - операція, розібрана з рядка скрипта.
+type command struct {
+	painter.Operation
+	text string
+	line int    // Номер рядка скрипта або з'єднання, з якого прочитано команду; 0, якщо невідомий
+	key  string // Ключ злиття у черзі; порожній, якщо команду не можна зливати
+}
+
+func (c command) String() string {
+	return c.text
+}
+
+func (c command) CoalesceKey() string {
+	return c.key
+}
+
+// withLine запам'ятовує номер рядка, з якого прочитано команду op.
+func withLine(op painter.Operation, line int) painter.Operation {
+	if c, ok := op.(command); ok {
+		c.line = line
+		return c
+	}
+	return op
+}
+
+func (p *Parser) parseOperation(cl string) (painter.Operation, error) {
+	parts, cols := splitFields(cl)
 
 	if len(parts) < 1 {
 		return nil, nil
@@ -72,63 +196,213 @@ func parseCommand(cl string) (painter.Operation, error) {
 
 	cmdType, ok := commandStrings[parts[0]]
 	if !ok {
-		return nil, fmt.Errorf("no such operation")
+		return nil, &ParseError{Column: cols[0], Token: parts[0], Err: noSuchOperation}
 	}
+	args := parts[1:]
 
-	coords, err := parseCoords(parts[1:])
-	if err != nil {
-		return nil, err
+	// Аргументи завжди є суфіксом parts, тому позицію аргументу можна обчислити за довжиною залишку.
+	fail := func(args []string, err error) (painter.Operation, error) {
+		i := len(parts) - len(args)
+		if i >= len(parts) {
+			// Бракує аргументів - вказуємо на саму команду.
+			i = 0
+		}
+		return nil, &ParseError{Column: cols[i], Token: parts[i], Expected: commandUsage[cmdType], Err: err}
+	}
+	arity := func() (painter.Operation, error) {
+		return nil, &ParseError{Column: cols[0], Token: parts[0], Expected: commandUsage[cmdType], Err: incorrectParamsNum}
 	}
 
 	switch cmdType {
 	case white:
-		return painter.OperationFunc(func(t screen.Texture) {
-			painter.WhiteFill(t)
-		}), nil
+		return painter.OperationFunc(painter.WhiteFill), nil
 	case green:
-		return painter.OperationFunc(func(t screen.Texture) {
-			painter.GreenFill(t)
+		return painter.OperationFunc(painter.GreenFill), nil
+	case fill:
+		if len(args) < 1 {
+			return arity()
+		}
+		c, err := parseColorArg(args, nil)
+		if err != nil {
+			return fail(args, err)
+		}
+		return painter.OperationFunc(func(s *painter.Scene) {
+			painter.Fill(s, c)
 		}), nil
 	case update:
 		return painter.UpdateOp, nil
 	case bgrect:
-		if len(parts) != 5 {
-			return nil, incorrectParamsNum
+		if len(args) < 4 {
+			return arity()
+		}
+		coords, n, err := parseCoords(args[:4])
+		if err != nil {
+			return fail(args[n:], err)
 		}
-		return painter.OperationFunc(func(t screen.Texture) {
-			painter.DrawBgRect(t, coords)
+		c, err := parseColorArg(args[4:], painter.DefaultRectColor)
+		if err != nil {
+			return fail(args[4:], err)
+		}
+		return painter.OperationFunc(func(s *painter.Scene) {
+			painter.DrawBgRect(s, coords, c)
 		}), nil
 	case figure:
-		if len(parts) != 3 {
-			return nil, incorrectParamsNum
+		// Ідентифікатор не може бути числом (зокрема nan чи inf): такий токен завжди є координатою, тому
+		// "figure 1 0.3 0.4" - це фігура без id у точці (1, 0.3) з масштабом 0.4.
+		id, rest := splitTarget(args)
+		if strings.ContainsAny(id, `*?[\`) {
+			return fail(args, fmt.Errorf("invalid figure id"))
+		}
+		args = rest
+		if len(args) < 2 {
+			return arity()
+		}
+		coords, n, err := parseCoords(args[:2])
+		if err != nil {
+			return fail(args[n:], err)
+		}
+		args = args[2:]
+
+		// Необов'язковий масштаб йде перед кольором: figure t1 0.5 0.5 0.5 red
+		scale := 1.0
+		if len(args) > 0 {
+			if _, err := strconv.ParseFloat(args[0], 64); err == nil {
+				v, err := parseNumber(args[0])
+				if err != nil {
+					return fail(args, err)
+				}
+				if v <= 0 || v > maxFigureScale {
+					return fail(args, fmt.Errorf("figure scale must be greater than 0 and at most %g", maxFigureScale))
+				}
+				scale, args = v, args[1:]
+			}
+		}
+
+		c, err := parseColorArg(args, painter.DefaultFigureColor)
+		if err != nil {
+			return fail(args, err)
 		}
-		return painter.OperationFunc(func(t screen.Texture) {
-			painter.DrawFigure(t, coords)
+		return painter.OperationFunc(func(s *painter.Scene) {
+			painter.DrawFigure(s, painter.Figure{
+				ID:    id,
+				X:     coords[0],
+				Y:     coords[1],
+				Scale: scale,
+				Color: c,
+			})
 		}), nil
-	case move:
-		if len(parts) != 3 {
-			return nil, incorrectParamsNum
+	case move, translate:
+		selector, rest := splitTarget(args)
+		if _, err := path.Match(selector, ""); err != nil {
+			return fail(args, fmt.Errorf("invalid figure selector"))
+		}
+		args = rest
+		if len(args) != 2 {
+			if len(args) > 2 {
+				return fail(args[2:], incorrectParamsNum)
+			}
+			return arity()
+		}
+		coords, n, err := parseCoords(args)
+		if err != nil {
+			return fail(args[n:], err)
+		}
+		if cmdType == translate {
+			return painter.OperationFunc(func(s *painter.Scene) {
+				painter.Translate(s, selector, coords)
+			}), nil
 		}
-		return painter.OperationFunc(func(t screen.Texture) {
-			painter.Move(t, coords)
+		return painter.OperationFunc(func(s *painter.Scene) {
+			painter.Move(s, selector, coords)
 		}), nil
 	case reset:
-		return painter.OperationFunc(func(t screen.Texture) {
-			painter.Reset(t)
-		}), nil
+		return painter.OperationFunc(painter.Reset), nil
+	case save, load:
+		if len(args) != 1 {
+			if len(args) > 1 {
+				return fail(args[1:], incorrectParamsNum)
+			}
+			return arity()
+		}
+		path, err := p.snapshotPath(args[0])
+		if err != nil {
+			return fail(args, err)
+		}
+		return &snapshotOp{name: args[0], path: path, load: cmdType == load}, nil
 	default:
 		return nil, nil
 	}
 }
 
-func parseCoords(coords []string) ([]float64, error) {
+// splitFields розбиває рядок на слова так само, як strings.Fields, додатково повертаючи номер символу
+// (починаючи з 1), з якого починається кожне слово.
+func splitFields(s string) (fields []string, cols []int) {
+	start, col := -1, 0
+	for i, r := range s {
+		col++
+		if unicode.IsSpace(r) {
+			if start >= 0 {
+				fields = append(fields, s[start:i])
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+			cols = append(cols, col)
+		}
+	}
+	if start >= 0 {
+		fields = append(fields, s[start:])
+	}
+	return
+}
+
+// splitTarget відокремлює необов'язковий перший аргумент команди, який не є числом: ідентифікатор фігури
+// (figure t1 0.3 0.4) або селектор фігур (move t* 0.5 0.5). Значення nan та inf вважаються числами, тому
+// потрапляють у parseCoords і відхиляються там.
+func splitTarget(args []string) (string, []string) {
+	if len(args) > 0 {
+		if _, err := strconv.ParseFloat(args[0], 64); err != nil {
+			return args[0], args[1:]
+		}
+	}
+	return "", args
+}
+
+// Найбільший масштаб фігури: більші значення не мають сенсу і переповнюють координати у painter.FigureRects.
+const maxFigureScale = 100.0
+
+// parseNumber розбирає скінченне число. strconv.ParseFloat також приймає nan та inf, але такі значення
+// неможливо ні намалювати, ні зберегти у JSON.
+func parseNumber(s string) (float64, error) {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number")
+	}
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("number must be finite")
+	}
+	return v, nil
+}
+
+// parseColorArg розбирає необов'язковий колір, який займає решту рядка команди, наприклад "rgb(0, 128, 255)".
+func parseColorArg(args []string, def color.Color) (color.Color, error) {
+	if len(args) == 0 {
+		return def, nil
+	}
+	return parseColor(strings.Join(args, " "))
+}
+
+// parseCoords розбирає числові аргументи. У разі помилки також повертає індекс аргументу, який не вдалося розібрати.
+func parseCoords(coords []string) ([]float64, int, error) {
 	var res []float64
-	for _, coord := range coords {
-		numCoord, err := strconv.ParseFloat(coord, 64)
+	for i, coord := range coords {
+		numCoord, err := parseNumber(coord)
 		if err != nil {
-			return nil, err
+			return nil, i, err
 		}
 		res = append(res, numCoord)
 	}
-	return res, nil
+	return res, 0, nil
 }
@@ -1,10 +1,14 @@
 package lang
 
 import (
+	"errors"
 	"fmt"
+	"image/color"
 	"io"
 	"strings"
 	"testing"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
 )
 
 func executeValidParser(parser Parser, command string) error {
@@ -109,56 +113,58 @@ func TestParse(t *testing.T) {
 }
 
 func TestParseCommand(t *testing.T) {
+	var parser Parser
+
 	// Wrong number of arguments
 	{
-		empValue, empErr := parseCommand("")
+		empValue, empErr := parser.parseCommand("")
 		if empValue != nil && empErr != nil {
 			t.Error("Empty command returns a value, while \"nil\" is expected")
 		}
 
-		_, bgrectErr := parseCommand("bgrect 0.1 0.2 0.3")
+		_, bgrectErr := parser.parseCommand("bgrect 0.1 0.2 0.3")
 		if bgrectErr == nil {
 			t.Error("Command \"bgrect\" doesn't throw an error with wrong number of args")
-		} else if bgrectErr.Error() != incorrectParamsNum.Error() {
+		} else if !errors.Is(bgrectErr, incorrectParamsNum) {
 			t.Error("Command \"bgrect\" throws an unexpected error:", incorrectParamsNum)
 		}
 
-		_, figureErr := parseCommand("figure 0.1")
+		_, figureErr := parser.parseCommand("figure 0.1")
 		if figureErr == nil {
 			t.Error("Command \"figure\" doesn't throw an error with wrong number of args")
-		} else if figureErr.Error() != incorrectParamsNum.Error() {
+		} else if !errors.Is(figureErr, incorrectParamsNum) {
 			t.Error("Command \"figure\" throws an unexpected error:", incorrectParamsNum)
 		}
 
-		_, moveErr := parseCommand("move 0.2")
+		_, moveErr := parser.parseCommand("move 0.2")
 		if moveErr == nil {
 			t.Error("Command \"move\" doesn't throw an error with wrong number of args")
-		} else if moveErr.Error() != incorrectParamsNum.Error() {
+		} else if !errors.Is(moveErr, incorrectParamsNum) {
 			t.Error("Command \"move\" throws an unexpected error:", incorrectParamsNum)
 		}
 	}
 
 	// Unreal command name
 	{
-		_, err := parseCommand("this_doesn't_exists")
-		if err == nil || err.Error() != "no such operation" {
+		_, err := parser.parseCommand("this_doesn't_exists")
+		if err == nil || !errors.Is(err, noSuchOperation) {
 			t.Error("Unreal command is parsed. Command: this_doesn't_exists")
 		}
 	}
 
 	// Simple commands
 	{
-		_, whiteErr := parseCommand("white")
+		_, whiteErr := parser.parseCommand("white")
 		if whiteErr != nil {
 			t.Error("Unexpected error during performing \"white\" operation")
 		}
 
-		_, greenErr := parseCommand("green")
+		_, greenErr := parser.parseCommand("green")
 		if greenErr != nil {
 			t.Error("Unexpected error during performing \"green\" operation")
 		}
 
-		_, updateErr := parseCommand("update")
+		_, updateErr := parser.parseCommand("update")
 		if updateErr != nil {
 			t.Error("Unexpected error during performing \"update\" operation")
 		}
@@ -169,10 +175,142 @@ func TestParseCommand(t *testing.T) {
 func TestParseCoords(t *testing.T) {
 	posActualCoords := []string{"-1.177", "28.33", "0.005"}
 
-	posParsedCoords, _ := parseCoords(posActualCoords)
+	posParsedCoords, _, _ := parseCoords(posActualCoords)
 
 	fmt.Println(posParsedCoords)
 
 	// Output:
 	// -1.177 28.33 0.0005
 }
+
+func TestParseColor(t *testing.T) {
+	valid := map[string]color.Color{
+		"#ff8000":             color.NRGBA{R: 0xff, G: 0x80, A: 0xff},
+		"#ff800080":           color.NRGBA{R: 0xff, G: 0x80, A: 0x80},
+		"#F80":                color.NRGBA{R: 0xff, G: 0x88, A: 0xff},
+		"#f808":               color.NRGBA{R: 0xff, G: 0x88, A: 0x88},
+		"rgb(1, 2, 3)":        color.NRGBA{R: 1, G: 2, B: 3, A: 0xff},
+		"rgba(1,2,3,0.5)":     color.NRGBA{R: 1, G: 2, B: 3, A: 0x80},
+		"CornflowerBlue":      color.NRGBA{R: 0x64, G: 0x95, B: 0xed, A: 0xff},
+		"transparent":         color.NRGBA{},
+		" rgb( 10 , 20 ,30 )": color.NRGBA{R: 10, G: 20, B: 30, A: 0xff},
+	}
+	for str, want := range valid {
+		c, err := parseColor(str)
+		if err != nil {
+			t.Errorf("Error with valid color %q: %v", str, err)
+		} else if c != want {
+			t.Errorf("Color %q parsed as %v, expected %v", str, c, want)
+		}
+	}
+
+	invalid := []string{"", "#12", "#12345", "#gggggg", "rgb(1, 2)", "rgb(256, 0, 0)", "rgba(1, 2, 3, 2)", "rgb(1, 2, 3", "notacolor"}
+	for _, str := range invalid {
+		if _, err := parseColor(str); err == nil {
+			t.Errorf("Error wasn't thrown with invalid color %q", str)
+		}
+	}
+}
+
+func TestParseCommand_Colors(t *testing.T) {
+	var parser Parser
+
+	for _, command := range []string{"fill red", "fill rgb(0, 0, 255)", "bgrect 0.1 0.1 0.2 0.2 #00ff00", "figure 0.5 0.5 rgba(0, 0, 0, 0.5)"} {
+		if _, err := parser.parseCommand(command); err != nil {
+			t.Errorf("Error with valid \"%v\" command: %v", command, err)
+		}
+	}
+	for _, command := range []string{"fill", "fill 0.5", "bgrect 0.1 0.1 0.2 0.2 0.3", "figure 0.5 0.5 nocolor"} {
+		if _, err := parser.parseCommand(command); err == nil {
+			t.Errorf("Error wasn't thrown with invalid \"%v\" command", command)
+		}
+	}
+}
+
+func TestParseCommand_FigureIds(t *testing.T) {
+	var parser Parser
+
+	for _, command := range []string{"figure t1 0.3 0.4", "figure t1 0.3 0.4 red", "figure 0.3 0.4 0.5", "figure t1 0.3 0.4 2 #ff0000", "figure 0 0 0.5", "figure 1 1 2", "figure 1 0.3 0.4 red", "move t1 0.5 0.5", "move * 0.5 0.5", "move t? 0.1 0.1", "translate 0.1 -0.1", "translate t1 0.1 0.1"} {
+		if _, err := parser.parseCommand(command); err != nil {
+			t.Errorf("Error with valid \"%v\" command: %v", command, err)
+		}
+	}
+	for _, command := range []string{"figure t* 0.3 0.4", "figure t1 0.3", "figure 0.3 0.4 0", "figure 0.3 0.4 -1 red", "figure 0.3 0.4 1 2", "move [ 0.5 0.5", "move t1 0.5", "translate 0.1", "translate t1 0.1 0.1 0.1"} {
+		if _, err := parser.parseCommand(command); err == nil {
+			t.Errorf("Error wasn't thrown with invalid \"%v\" command", command)
+		}
+	}
+}
+
+func TestParseCommand_NonFinite(t *testing.T) {
+	var parser Parser
+
+	for _, command := range []string{"move nan 0.5", "move t1 0.5 inf", "translate -Infinity 0", "bgrect 0 0 +inf 1", "figure 0.5 NaN", "figure t1 0.5 0.5 nan", "figure 0.5 0.5 1e300", "figure 0.5 0.5 101", "fill rgba(0, 0, 0, nan)"} {
+		if _, err := parser.parseCommand(command); err == nil {
+			t.Errorf("Error wasn't thrown with invalid \"%v\" command", command)
+		}
+	}
+	if _, err := parser.parseCommand("figure 0.5 0.5 100"); err != nil {
+		t.Error("Error with the largest figure scale:", err)
+	}
+}
+
+func TestParse_Error(t *testing.T) {
+	parser := Parser{}
+	cases := []struct {
+		script string
+		want   ParseError
+	}{
+		{"white\nupdate\nunknown 1 2", ParseError{Line: 3, Column: 1, Token: "unknown", Err: noSuchOperation}},
+		{"white\n  bgrect 0.1 0.1 0.2", ParseError{Line: 2, Column: 3, Token: "bgrect", Expected: "bgrect x1 y1 x2 y2 [color]", Err: incorrectParamsNum}},
+		{"figure 0.1 abc", ParseError{Line: 1, Column: 12, Token: "abc", Expected: "figure [id] x y [scale] [color]"}},
+		{"figure inf 0.3 0.4", ParseError{Line: 1, Column: 8, Token: "inf", Expected: "figure [id] x y [scale] [color]"}},
+		{"move nan 0.5", ParseError{Line: 1, Column: 6, Token: "nan", Expected: "move [selector] x y"}},
+		{"move t1 0.1 0.2 0.3", ParseError{Line: 1, Column: 17, Token: "0.3", Expected: "move [selector] x y", Err: incorrectParamsNum}},
+		{"green\n\nfill  nocolor", ParseError{Line: 3, Column: 7, Token: "nocolor", Expected: "fill <color>"}},
+	}
+
+	for _, c := range cases {
+		_, err := parser.Parse(strings.NewReader(c.script))
+		var pe *ParseError
+		if !errors.As(err, &pe) {
+			t.Errorf("Script %q: expected ParseError, got %v", c.script, err)
+			continue
+		}
+		if pe.Line != c.want.Line || pe.Column != c.want.Column || pe.Token != c.want.Token || pe.Expected != c.want.Expected {
+			t.Errorf("Script %q: unexpected error %q", c.script, pe)
+		}
+		if c.want.Err != nil && !errors.Is(err, c.want.Err) {
+			t.Errorf("Script %q: unexpected cause %v", c.script, pe.Err)
+		}
+	}
+}
+
+func TestParser_CoalesceKey(t *testing.T) {
+	var parser Parser
+	keys := map[string]string{
+		"white":                "fill",
+		"fill #ff0000":         "fill",
+		"update":               painter.UpdateKey,
+		"move 0.5 0.5":         "move *",
+		"move * 0.5 0.5":       "move *",
+		"move t1 0.5 0.5":      "move t1",
+		"translate t1 0.1 0.1": "",
+		"figure t1 0.5 0.5":    "",
+		"bgrect 0 0 0.5 0.5":   "",
+		"reset":                "",
+	}
+	for cmd, want := range keys {
+		op, err := parser.parseCommand(cmd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, ok := op.(painter.Coalescable)
+		if !ok {
+			t.Fatalf("%q: operation %T has no coalesce key", cmd, op)
+		}
+		if got := c.CoalesceKey(); got != want {
+			t.Errorf("%q: key %q, expected %q", cmd, got, want)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package lang
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Кількість клієнтів, після якої RateLimiter видаляє записи про клієнтів, чиї відра вже повністю наповнилися.
+const rateLimiterPrune = 1024
+
+// RateLimiter обмежує частоту запитів кожного клієнта за алгоритмом token bucket: відро місткістю Burst
+// поповнюється зі швидкістю Rate запитів на секунду, а кожен запит забирає з нього один токен. Клієнт визначається
+// за токеном автентифікації (див. Auth), а без нього - за IP адресою. Nil *RateLimiter не обмежує запити.
+type RateLimiter struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter створює обмежувач на rate запитів на секунду з можливими сплесками до burst запитів.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	return &RateLimiter{
+		rate:    rate,
+		burst:   math.Max(float64(burst), 1),
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Limit конструює обробник, який відповідає 429 Too Many Requests клієнтам, що перевищили ліміт, і передає
+// решту запитів у h. Щоб запити розрізнялися за токеном, Limit потрібно викликати всередині Auth.Require.
+func (rl *RateLimiter) Limit(h http.Handler) http.Handler {
+	if rl == nil {
+		return h
+	}
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if wait := rl.reserve(clientKey(r)); wait > 0 {
+			rw.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeError(rw, http.StatusTooManyRequests, "rate_limited", "too many requests")
+			return
+		}
+		h.ServeHTTP(rw, r)
+	})
+}
+
+// reserve забирає токен з відра клієнта. Якщо токенів немає, повертає час, через який з'явиться наступний.
+func (rl *RateLimiter) reserve(key string) time.Duration {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := rl.now()
+	if len(rl.buckets) >= rateLimiterPrune {
+		rl.prune(now)
+	}
+
+	b, ok := rl.buckets[key]
+	if !ok {
+		b = &bucket{tokens: rl.burst, last: now}
+		rl.buckets[key] = b
+	}
+	b.tokens = math.Min(rl.burst, b.tokens+now.Sub(b.last).Seconds()*rl.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / rl.rate * float64(time.Second))
+	}
+	b.tokens--
+	return 0
+}
+
+// prune видаляє відра, які вже встигли наповнитися: для таких клієнтів новий запис нічим не відрізняється від старого.
+func (rl *RateLimiter) prune(now time.Time) {
+	for key, b := range rl.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*rl.rate >= rl.burst {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+func clientKey(r *http.Request) string {
+	if tok := requestToken(r.Context()); tok != nil {
+		return "token:" + tok.Name
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
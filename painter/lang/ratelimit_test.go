@@ -0,0 +1,60 @@
+package lang
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	rl := NewRateLimiter(2, 3)
+	now := time.Unix(1700000000, 0)
+	rl.now = func() time.Time { return now }
+
+	h := rl.Limit(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusNoContent)
+	}))
+	request := func(addr string) int {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = addr
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec.Code
+	}
+
+	// Сплеск до Burst запитів дозволено, наступний запит відхиляється.
+	for i := 0; i < 3; i++ {
+		if code := request("10.0.0.1:1000"); code != http.StatusNoContent {
+			t.Fatalf("Request %d was rejected with %d", i, code)
+		}
+	}
+	if code := request("10.0.0.1:1001"); code != http.StatusTooManyRequests {
+		t.Error("Request over the burst was not limited:", code)
+	}
+
+	// Інші клієнти мають власні відра.
+	if code := request("10.0.0.2:1000"); code != http.StatusNoContent {
+		t.Error("Request from another client was limited:", code)
+	}
+
+	// За пів секунди з швидкістю 2 запити на секунду з'являється один токен.
+	now = now.Add(500 * time.Millisecond)
+	if code := request("10.0.0.1:1000"); code != http.StatusNoContent {
+		t.Error("Bucket was not refilled:", code)
+	}
+	if code := request("10.0.0.1:1000"); code != http.StatusTooManyRequests {
+		t.Error("Request over the rate was not limited:", code)
+	}
+
+	// Клієнти з токеном розрізняються за ним, а не за адресою.
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.1:1000"
+	r = r.WithContext(context.WithValue(r.Context(), tokenKey{}, &Token{Name: "bot"}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	if rec.Code != http.StatusNoContent {
+		t.Error("Authenticated client shares the bucket with its address:", rec.Code)
+	}
+}
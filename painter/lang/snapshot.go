@@ -0,0 +1,128 @@
+package lang
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"path/filepath"
+	"regexp"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+	"golang.org/x/exp/shiny/screen"
+)
+
+// Назва збереженої сцени стає назвою файлу, тому допускаються лише безпечні символи.
+var snapshotName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// snapshotPath повертає шлях до файлу, у якому зберігається сцена з вказаною назвою.
+func (p *Parser) snapshotPath(name string) (string, error) {
+	if !snapshotName.MatchString(name) {
+		return "", fmt.Errorf("invalid scene name")
+	}
+	return filepath.Join(p.StateDir, name+".json"), nil
+}
+
+// snapshotOp зберігає сцену у файл або замінює її збереженою. Файл читається повністю до зміни сцени, тому
+// у разі помилки сцена залишається незмінною. Помилка логується та запам'ятовується в err, щоб після Exec
+// її можна було повернути клієнту. Після відновлення сцени операція одразу відображає новий кадр.
+type snapshotOp struct {
+	name, path string
+	load       bool
+	err        error
+}
+
+func (op *snapshotOp) Do(t screen.Texture, s *painter.Scene) bool {
+	painter.OperationFunc(op.run).Do(t, s)
+	return op.load && op.err == nil
+}
+
+func (op *snapshotOp) run(s *painter.Scene) {
+	action := "save"
+	if op.load {
+		action = "load"
+		var saved *painter.Scene
+		if saved, op.err = painter.LoadScene(op.path); op.err == nil {
+			painter.Restore(s, saved)
+		}
+	} else {
+		op.err = painter.SaveScene(op.path, s)
+	}
+	if op.err != nil {
+		log.Printf("Cannot %s scene %q: %s", action, op.name, op.err)
+	}
+}
+
+// failedSnapshot повертає першу з команд save та load у ops, виконання якої завершилося помилкою, та її рядок.
+// Викликається лише після того, як Exec дочекався виконання ops.
+func failedSnapshot(ops []painter.Operation) (*snapshotOp, int) {
+	for _, op := range ops {
+		c, ok := op.(command)
+		if !ok {
+			continue
+		}
+		if sop, ok := c.Operation.(*snapshotOp); ok && sop.err != nil {
+			return sop, c.line
+		}
+	}
+	return nil, 0
+}
+
+// writeSnapshotError повідомляє про невдале збереження або відновлення сцени.
+func writeSnapshotError(rw http.ResponseWriter, op *snapshotOp, line int) {
+	status, re := http.StatusInternalServerError, &ResponseError{Code: "snapshot_failed", Message: op.err.Error(), Line: line}
+	if errors.Is(op.err, fs.ErrNotExist) {
+		status, re.Code, re.Message = http.StatusNotFound, "not_found", fmt.Sprintf("scene %q does not exist", op.name)
+	}
+	writeJSON(rw, status, Response{Error: re})
+}
+
+// SnapshotResult - результат збереження або відновлення сцени.
+type SnapshotResult struct {
+	Name string `json:"name"`
+}
+
+// SaveHandler конструює обробник POST /save?name=<name>, який зберігає поточну сцену у файл.
+// Відповідь надсилається після того, як цикл виконав збереження.
+func SaveHandler(loop *painter.Loop, p *Parser) http.Handler {
+	return snapshotHandler(loop, p, false)
+}
+
+// LoadHandler конструює обробник POST /load?name=<name>, який замінює сцену збереженою раніше.
+// Відповідь надсилається після того, як цикл відновив сцену та відобразив її.
+func LoadHandler(loop *painter.Loop, p *Parser) http.Handler {
+	return snapshotHandler(loop, p, true)
+}
+
+func snapshotHandler(loop *painter.Loop, p *Parser, load bool) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			rw.Header().Set("Allow", "POST")
+			writeError(rw, http.StatusMethodNotAllowed, "method_not_allowed", "method "+r.Method+" is not allowed")
+			return
+		}
+
+		name := r.URL.Query().Get("name")
+		path, err := p.snapshotPath(name)
+		if err != nil {
+			writeError(rw, http.StatusBadRequest, "bad_name", fmt.Sprintf("invalid scene name %q", name))
+			return
+		}
+
+		// Операція виконується у циклі подій, тому помилку можна прочитати лише після завершення Exec.
+		op := &snapshotOp{name: name, path: path, load: load}
+		ctx, cancel := context.WithTimeout(r.Context(), MaxWait)
+		defer cancel()
+		if _, err := loop.Exec(ctx, op); err != nil {
+			writeExecError(rw, err)
+			return
+		}
+		if op.err != nil {
+			writeSnapshotError(rw, op, 0)
+			return
+		}
+		writeJSON(rw, http.StatusOK, Response{OK: true, Result: SnapshotResult{Name: name}})
+	})
+}
@@ -0,0 +1,114 @@
+package lang
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+	"github.com/roman-mazur/architecture-lab-3/ui/headless"
+)
+
+func TestParse_SaveLoad(t *testing.T) {
+	var (
+		l  painter.Loop
+		fr frameRecorder
+	)
+	p := Parser{StateDir: t.TempDir()}
+	l.Receiver = &fr
+	l.Start(headless.Screen{})
+	defer l.StopAndWait()
+
+	exec := func(script string) {
+		ops, err := p.Parse(strings.NewReader(script))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := l.Exec(context.Background(), painter.OperationList(ops)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	state := func() string {
+		data, _ := json.Marshal(l.Scene())
+		return string(data)
+	}
+
+	exec("fill red\nbgrect 0.1 0.1 0.5 0.5\nfigure t1 0.3 0.3\nsave first")
+	saved := state()
+	if _, err := os.Stat(filepath.Join(p.StateDir, "first.json")); err != nil {
+		t.Fatal("Scene was not saved:", err)
+	}
+
+	exec("reset\nfigure t2 0.6 0.6")
+	exec("load first")
+	if got := state(); got != saved {
+		t.Errorf("Scene was not restored:\n%s\nexpected:\n%s", got, saved)
+	}
+
+	// Невдале відновлення не змінює сцену.
+	exec("load missing")
+	if got := state(); got != saved {
+		t.Errorf("Scene changed after failed load:\n%s", got)
+	}
+
+	for _, command := range []string{"save", "save ../escape", "load a b", "save a/b"} {
+		if _, err := p.parseCommand(command); err == nil {
+			t.Errorf("Error wasn't thrown with invalid \"%v\" command", command)
+		}
+	}
+}
+
+func TestSnapshotHandlers(t *testing.T) {
+	var (
+		l  painter.Loop
+		fr frameRecorder
+	)
+	p := Parser{StateDir: t.TempDir()}
+	l.Receiver = &fr
+	l.Start(headless.Screen{})
+	defer l.StopAndWait()
+
+	save, load := SaveHandler(&l, &p), LoadHandler(&l, &p)
+	l.Post(painter.OperationFunc(painter.GreenFill))
+
+	cases := []struct {
+		h      http.Handler
+		req    *http.Request
+		status int
+	}{
+		{save, httptest.NewRequest(http.MethodPost, "/save?name=green", nil), http.StatusOK},
+		{save, httptest.NewRequest(http.MethodGet, "/save?name=green", nil), http.StatusMethodNotAllowed},
+		{save, httptest.NewRequest(http.MethodPost, "/save?name=..", nil), http.StatusBadRequest},
+		{load, httptest.NewRequest(http.MethodPost, "/load?name=missing", nil), http.StatusNotFound},
+		{load, httptest.NewRequest(http.MethodPost, "/load?name=green", nil), http.StatusOK},
+	}
+	for i, c := range cases {
+		if i == 1 {
+			l.Post(painter.OperationFunc(painter.Reset))
+		}
+		rec := httptest.NewRecorder()
+		c.h.ServeHTTP(rec, c.req)
+		if rec.Code != c.status {
+			t.Errorf("%s %s: status %d, expected %d", c.req.Method, c.req.URL, rec.Code, c.status)
+		}
+	}
+
+	if r, g, b, _ := l.Scene().Bgc.RGBA(); r != 0 || g != 0xffff || b != 0 {
+		t.Error("Scene was not restored:", l.Scene())
+	}
+	// Відновлена сцена одразу відображається.
+	if l.Frame() != 1 {
+		t.Errorf("Loop sent %d frames after load, expected 1", l.Frame())
+	}
+
+	// Невдале відновлення у синхронному скрипті повертається клієнту разом з рядком команди.
+	rec, resp := serve(HttpHandler(&l, &p), httptest.NewRequest(http.MethodPost, "/?wait=1", strings.NewReader("green\nload missing\nupdate")))
+	if rec.Code != http.StatusNotFound || resp.Error == nil || resp.Error.Code != "not_found" || resp.Error.Line != 2 {
+		t.Errorf("Unexpected response to a failed load: %d %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,40 @@
+package lang
+
+import (
+	"net/http"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+)
+
+// State описує поточний стан циклу подій, який повертає StateHandler.
+type State struct {
+	Scene   *painter.Scene `json:"scene"`   // Поточна сцена, включно зі змінами, які ще не були відображені
+	Pending int            `json:"pending"` // Кількість операцій у черзі
+	Frame   uint64         `json:"frame"`   // Номер останнього відображеного кадру
+	Stats   FrameStats     `json:"stats"`
+}
+
+// FrameStats - статистика кадрів циклу разом з частотою кадрів, яку painter.FrameStats лише обчислює.
+type FrameStats struct {
+	painter.FrameStats
+	FPS float64 `json:"fps"`
+}
+
+// StateHandler конструює обробник, який повертає поточний стан сцени у форматі JSON.
+func StateHandler(loop *painter.Loop) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			rw.Header().Set("Allow", "GET, HEAD")
+			writeError(rw, http.StatusMethodNotAllowed, "method_not_allowed", "method "+r.Method+" is not allowed")
+			return
+		}
+
+		stats := loop.Stats()
+		writeJSON(rw, http.StatusOK, Response{OK: true, Result: State{
+			Scene:   loop.Scene(),
+			Pending: loop.Pending(),
+			Frame:   loop.Frame(),
+			Stats:   FrameStats{FrameStats: stats, FPS: stats.FPS()},
+		}})
+	})
+}
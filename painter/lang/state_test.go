@@ -0,0 +1,61 @@
+package lang
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+	"github.com/roman-mazur/architecture-lab-3/ui/headless"
+)
+
+func TestStateHandler(t *testing.T) {
+	var (
+		l  painter.Loop
+		p  Parser
+		fr frameRecorder
+	)
+	l.Receiver = &fr
+	l.Start(headless.Screen{})
+	defer l.StopAndWait()
+
+	ops, err := p.Parse(strings.NewReader("fill #123456\nbgrect 0 0 0.5 0.5\nfigure t1 0.2 0.3\nfigure t2 0.4 0.5 red\nupdate\nmove t2 0.6 0.7"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Exec(context.Background(), painter.OperationList(ops)); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	StateHandler(&l).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/state", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Unexpected status %d", rec.Code)
+	}
+
+	var resp struct {
+		OK     bool
+		Result struct {
+			Scene   json.RawMessage
+			Pending int
+			Frame   uint64
+			Stats   struct {
+				Frames uint64
+			}
+		}
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"background":"#123456ff","rects":[{"x1":0,"y1":0,"x2":0.5,"y2":0.5,"color":"#000000ff"}],` +
+		`"figures":[{"id":"t1","x":0.2,"y":0.3,"scale":1,"color":"#ffff00ff"},{"id":"t2","x":0.6,"y":0.7,"scale":1,"color":"#ff0000ff"}]}`
+	if !resp.OK || string(resp.Result.Scene) != want {
+		t.Errorf("Unexpected scene %s", resp.Result.Scene)
+	}
+	if resp.Result.Frame != 1 || resp.Result.Pending != 0 || resp.Result.Stats.Frames != 1 {
+		t.Errorf("Unexpected state %+v", resp.Result)
+	}
+}
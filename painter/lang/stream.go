@@ -0,0 +1,38 @@
+package lang
+
+import (
+	"strings"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+)
+
+// lineExecutor виконує команди, які надходять по одній на рядок через постійне з'єднання. Кожен рядок розбирається
+// окремо, а його операція одразу додається у чергу циклу, тому помилка в одному рядку не скасовує інші.
+type lineExecutor struct {
+	loop   *painter.Loop
+	parser *Parser
+	line   int    // Кількість оброблених рядків з початку з'єднання
+	token  *Token // Токен, з яким автентифіковано з'єднання; nil, якщо автентифікацію вимкнено
+}
+
+// exec обробляє один рядок. Повертає *ParseError з номером рядка в межах з'єднання, якщо рядок не вдалося розібрати,
+// *PermissionError, якщо токен з'єднання не дозволяє виконати команду, або painter.ErrQueueFull.
+func (le *lineExecutor) exec(line string) error {
+	le.line++
+
+	op, err := le.parser.parseCommand(strings.TrimSuffix(line, "\r"))
+	if err != nil {
+		if pe, ok := err.(*ParseError); ok {
+			pe.Line = le.line
+		}
+		return err
+	}
+	if op != nil {
+		op = withLine(op, le.line)
+		if err := authorizeCommand(le.token, op); err != nil {
+			return err
+		}
+		return le.loop.Post(op)
+	}
+	return nil
+}
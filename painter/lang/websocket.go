@@ -0,0 +1,52 @@
+package lang
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+)
+
+// LineAck - відповідь на один рядок, отриманий через WebSocket.
+type LineAck struct {
+	Line  int            `json:"line"`
+	OK    bool           `json:"ok"`
+	Error *ResponseError `json:"error,omitempty"`
+}
+
+// WebSocketHandler конструює обробник WebSocket з'єднань. Кожне текстове повідомлення може містити одну або декілька
+// команд, розділених символом нового рядка. На кожен рядок клієнт отримує LineAck у форматі JSON.
+func WebSocketHandler(loop *painter.Loop, p *Parser) http.Handler {
+	// websocket.Server без Handshake не перевіряє Origin, тому до нього можуть під'єднуватися клієнти поза браузером.
+	return websocket.Server{Handler: func(ws *websocket.Conn) {
+		defer ws.Close()
+		le := lineExecutor{loop: loop, parser: p, token: requestToken(ws.Request().Context())}
+
+		for {
+			var msg string
+			if err := websocket.Message.Receive(ws, &msg); err != nil {
+				if err != io.EOF {
+					log.Printf("WebSocket receive failed: %s", err)
+				}
+				return
+			}
+
+			for _, line := range strings.Split(strings.TrimSuffix(msg, "\n"), "\n") {
+				ack := LineAck{OK: true}
+				if err := le.exec(line); err != nil {
+					ack.OK, ack.Error = false, responseError(err)
+				}
+				ack.Line = le.line
+
+				if err := websocket.JSON.Send(ws, ack); err != nil {
+					log.Printf("WebSocket send failed: %s", err)
+					return
+				}
+			}
+		}
+	}}
+}
@@ -0,0 +1,64 @@
+package lang
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+	"github.com/roman-mazur/architecture-lab-3/ui/headless"
+)
+
+func TestWebSocketHandler(t *testing.T) {
+	var (
+		l  painter.Loop
+		p  Parser
+		fr frameRecorder
+	)
+	l.Receiver = &fr
+	l.Start(headless.Screen{})
+	defer l.StopAndWait()
+
+	srv := httptest.NewServer(WebSocketHandler(&l, &p))
+	defer srv.Close()
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), "", srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	for _, msg := range []string{"green\nfigure t1 0.5 0.5\n", "move t1 0.1\n", "move t1 0.2 0.2\r\nupdate"} {
+		if err := websocket.Message.Send(ws, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []LineAck{
+		{Line: 1, OK: true},
+		{Line: 2, OK: true},
+		{Line: 3, Error: &ResponseError{Code: "bad_script", Message: incorrectParamsNum.Error(), Line: 3, Column: 1, Token: "move", Expected: "move [selector] x y"}},
+		{Line: 4, OK: true},
+		{Line: 5, OK: true},
+	}
+	for _, w := range want {
+		var ack LineAck
+		if err := websocket.JSON.Receive(ws, &ack); err != nil {
+			t.Fatal(err)
+		}
+		if ack.Line != w.Line || ack.OK != w.OK || (w.Error != nil && (ack.Error == nil || *ack.Error != *w.Error)) {
+			t.Errorf("Unexpected ack %+v (error %+v), expected %+v", ack, ack.Error, w)
+		}
+	}
+
+	// Операції з WebSocket потрапляють у ту саму чергу, тому після Exec усі вони вже виконані.
+	if _, err := l.Exec(context.Background(), painter.UpdateOp); err != nil {
+		t.Fatal(err)
+	}
+	if f := l.Scene().Figures; len(f) != 1 || f[0].X != 0.2 {
+		t.Error("Commands were not applied:", f)
+	}
+}
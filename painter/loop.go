@@ -1,8 +1,17 @@
 package painter
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"image"
+	"log"
+	"runtime/debug"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"golang.org/x/exp/shiny/screen"
 )
@@ -15,54 +24,446 @@ type Receiver interface {
 // Loop реалізує цикл подій для формування текстури отриманої через виконання операцій отриманих з внутрішньої черги.
 type Loop struct {
 	Receiver Receiver
+	Size     image.Point // Розмір текстур, які формує цикл. Якщо не вказано, використовується DefaultSize
+
+	// QueueCap обмежує кількість операцій, які очікують у черзі. Нульове значення означає необмежену чергу.
+	// Разом з QueuePolicy має бути встановлений до виклику Start.
+	QueueCap int
+	// QueuePolicy визначає, що робить Post, коли черга заповнена.
+	QueuePolicy QueuePolicy
+	// OnError отримує помилки операцій, які завершилися панікою (*OperationError). Викликається з горутини
+	// циклу, тому не повинен блокуватися. Якщо не вказано, помилки записуються у журнал.
+	OnError func(err error)
+
+	// Coalesce вмикає злиття операцій у черзі (див. Coalescable). Має бути встановлений до виклику Start.
+	Coalesce bool
+	// MaxFPS обмежує частоту відправлення кадрів у Receiver. Оновлення, що надходять частіше, об'єднуються
+	// з наступними. Нульове значення вимикає обмеження.
+	MaxFPS float64
 
 	next screen.Texture // Текстура, яка зараз формується
 	prev screen.Texture // Текстура, яка була відправлення останнього разу у Receiver
 
+	frame atomic.Uint64 // Кількість кадрів, відправлених у Receiver
+
+	mu    sync.Mutex // Захищає scene та last; утримується під час виконання кожної операції
+	scene *Scene     // Стан полотна, який змінюють операції цього циклу
+	last  *Scene     // Копія сцени, з якої був сформований останній відправлений кадр
+
+	ran []string // Описи операцій, виконаних після останнього відправленого кадру
+
+	dirty       bool       // Чи є оновлення, для якого ще не відправлено кадр
+	stale       bool       // Чи не відображає next поточний стан сцени (після обміну текстур)
+	lastPresent time.Time  // Час відправлення останнього кадру
+	stats       FrameStats // Захищена mu
+
+	subMu sync.Mutex
+	subs  map[chan FrameEvent]struct{}
+
 	mq messageQueue
 
-	stop    chan struct{}
-	stopReq bool
+	stop chan struct{} // Закривається, коли горутина циклу завершилася
 }
 
-var size = image.Pt(800, 800)
+// DefaultSize - розмір текстур циклу подій за замовчуванням.
+var DefaultSize = image.Pt(800, 800)
 
-// Start запускає цикл подій. Цей метод потрібно запустити до того, як викликати на ньому будь-які інші методи.
-func (l *Loop) Start(s screen.Screen) {
-	l.next, _ = s.NewTexture(size)
-	l.prev, _ = s.NewTexture(size)
+// QueuePolicy - поведінка Post, коли у черзі вже QueueCap операцій.
+type QueuePolicy int
 
+const (
+	QueueBlock      QueuePolicy = iota // Post чекає, доки у черзі звільниться місце
+	QueueDropOldest                    // Найстаріша операція у черзі відкидається, щоб звільнити місце для нової
+	QueueReject                        // Post не додає операцію та повертає ErrQueueFull
+)
+
+var (
+	// ErrQueueFull повертається з Post та Exec, коли черга заповнена і встановлено політику QueueReject.
+	ErrQueueFull = errors.New("painter: operation queue is full")
+	// ErrDropped повертається з Exec, якщо операцію було відкинуто з черги за політикою QueueDropOldest.
+	ErrDropped = errors.New("painter: operation was dropped from the queue")
+	// ErrStopped повертається з Post та Exec після того, як цикл почав зупинку.
+	ErrStopped = errors.New("painter: loop is stopped")
+)
+
+// Start запускає цикл подій. До його виклику можна лише додавати операції через Post та читати Scene;
+// решту методів потрібно викликати після Start.
+// Повертає помилку, якщо не вдалося створити текстури; у такому разі цикл не запускається.
+func (l *Loop) Start(s screen.Screen) error {
+	if l.Size.X <= 0 || l.Size.Y <= 0 {
+		l.Size = DefaultSize
+	}
+	next, err := s.NewTexture(l.Size)
+	if err != nil {
+		return fmt.Errorf("painter: cannot create texture: %w", err)
+	}
+	prev, err := s.NewTexture(l.Size)
+	if err != nil {
+		next.Release()
+		return fmt.Errorf("painter: cannot create texture: %w", err)
+	}
+	l.next, l.prev = next, prev
+	l.stale = true
+
+	// HTTP обробники можуть звертатися до циклу ще до завершення Start, тому сцена та налаштування черги
+	// змінюються під відповідними блокуваннями.
+	l.mu.Lock()
+	l.scene = NewScene()
+	l.mu.Unlock()
+	l.mq.configure(l.QueueCap, l.QueuePolicy, l.Coalesce)
 	l.stop = make(chan struct{})
 
 	go func() {
-		for !(l.stopReq && l.mq.empty()) {
-			op := l.mq.pull()
+		for {
+			op, ok := l.mq.pull()
+			if !ok {
+				break
+			}
 
 			// Значення true повертається лише тоді, коли
 			// Операція хоче перемалювати вікно після свого виконання
-			update := op.Do(l.next)
+			update, drawn, err := l.do(op)
+			l.ran = describe(l.ran, op)
+			if err != nil {
+				// Операція могла не домалювати текстуру, тому кадр потрібно сформувати заново зі сцени.
+				l.report(err)
+				l.stale = true
+			} else if drawn {
+				l.stale = false
+			}
+
 			if update {
-				l.Receiver.Update(l.next)
-				l.next, l.prev = l.prev, l.next
+				if l.dirty {
+					l.mu.Lock()
+					l.stats.Merged++
+					l.mu.Unlock()
+				}
+				l.dirty = true
+			}
+
+			// Той, хто чекає через Exec, має отримати номер кадру, у якому відображено його операцію.
+			e, isExec := op.(*execOp)
+			if l.dirty && l.paceFrame(isExec) {
+				l.present()
+			}
+			if isExec {
+				e.err = err
+				e.done <- Result{Updated: update, Frame: l.frame.Load()}
 			}
 		}
 		close(l.stop)
 	}()
+	return nil
+}
+
+// OperationError описує операцію, виконання якої завершилося панікою. Цикл продовжує роботу з наступної операції,
+// але сцена може залишитися частково зміненою.
+type OperationError struct {
+	Op    string // Опис операції (див. FrameEvent.Ops) або її тип
+	Panic any    // Значення, передане у panic
+	Stack []byte // Стек горутини циклу в момент паніки
+}
+
+func (e *OperationError) Error() string {
+	return fmt.Sprintf("painter: operation %s panicked: %v", e.Op, e.Panic)
 }
 
-// Post додає нову операцію у внутрішню чергу.
-func (l *Loop) Post(op Operation) {
-	l.mq.push(op)
+// do виконує операцію, перетворюючи паніку на *OperationError.
+// do виконує операцію над next. Значення drawn показує, чи перемалювала операція текстуру зі сцени
+// (див. CreateTexture); операції, які нічого не малюють, залишають у next попередній вміст.
+func (l *Loop) do(op Operation) (update, drawn bool, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	defer func() {
+		if r := recover(); r != nil {
+			name := strings.Join(describe(nil, op), "; ")
+			if name == "" {
+				name = fmt.Sprintf("%T", op)
+			}
+			err = &OperationError{Op: name, Panic: r, Stack: debug.Stack()}
+		}
+	}()
+
+	t := &frameTexture{Texture: l.next}
+	update = op.Do(t, l.scene)
+	return update, t.drawn, nil
+}
+
+// frameTexture - текстура, яку цикл передає операціям. CreateTexture позначає її перемальованою.
+type frameTexture struct {
+	screen.Texture
+	drawn bool
+}
+
+func (l *Loop) report(err error) {
+	if l.OnError != nil {
+		l.OnError(err)
+		return
+	}
+	var oe *OperationError
+	if errors.As(err, &oe) {
+		log.Printf("%s\n%s", err, oe.Stack)
+	}
+}
+
+// paceFrame визначає, чи можна відправити кадр зараз. З обмеженням MaxFPS кадр відкладається, поки у черзі є
+// операції, які його змінять; якщо черга порожня або force, цикл чекає до моменту, коли кадр можна відправити.
+func (l *Loop) paceFrame(force bool) bool {
+	if l.MaxFPS <= 0 || l.lastPresent.IsZero() {
+		return true
+	}
+	wait := time.Until(l.lastPresent.Add(time.Duration(float64(time.Second) / l.MaxFPS)))
+	if wait <= 0 {
+		return true
+	}
+	if !force && !l.mq.empty() {
+		return false
+	}
+	time.Sleep(wait)
+	return true
+}
+
+// present відправляє підготовлену текстуру у Receiver та повідомляє підписників про новий кадр.
+func (l *Loop) present() {
+	// Після обміну текстур next містить кадр до попереднього, тому якщо після нього жодна операція не перемалювала
+	// текстуру зі сцени, її потрібно перемалювати.
+	if l.stale {
+		l.mu.Lock()
+		CreateTexture(l.next, l.scene)
+		l.mu.Unlock()
+	}
+
+	start := time.Now()
+	l.Receiver.Update(l.next)
+	took := time.Since(start)
+	l.next, l.prev = l.prev, l.next
+
+	l.mu.Lock()
+	l.last = l.scene.Clone()
+	frame := l.frame.Add(1)
+	l.stats.record(start, took)
+	l.mu.Unlock()
+
+	l.publish(FrameEvent{Frame: frame, Time: start, Ops: l.ran, Scene: l.last})
+	l.ran = nil
+	l.dirty, l.stale = false, true
+	l.lastPresent = start
+}
+
+// FrameStats - статистика відправлення кадрів у Receiver. Середні значення експоненційно згладжені, тому
+// відображають останні кадри.
+type FrameStats struct {
+	Frames         uint64        `json:"frames"`
+	Merged         uint64        `json:"merged"` // Оновлення, які не отримали окремого кадру через MaxFPS
+	LastFrame      time.Time     `json:"last_frame"`
+	Interval       time.Duration `json:"interval_ns"`         // Середній інтервал між кадрами
+	PresentTime    time.Duration `json:"present_time_ns"`     // Середній час виконання Receiver.Update
+	MaxPresentTime time.Duration `json:"max_present_time_ns"` // Найдовше виконання Receiver.Update
+}
+
+// Коефіцієнт згладжування середніх значень у FrameStats.
+const statsSmoothing = 0.1
+
+func (s *FrameStats) record(at time.Time, took time.Duration) {
+	smooth := func(avg, v time.Duration) time.Duration {
+		return avg + time.Duration(float64(v-avg)*statsSmoothing)
+	}
+
+	if s.Frames == 0 {
+		s.PresentTime = took
+	} else {
+		s.PresentTime = smooth(s.PresentTime, took)
+		if s.Frames == 1 {
+			s.Interval = at.Sub(s.LastFrame)
+		} else {
+			s.Interval = smooth(s.Interval, at.Sub(s.LastFrame))
+		}
+	}
+	s.MaxPresentTime = max(s.MaxPresentTime, took)
+	s.LastFrame = at
+	s.Frames++
+}
+
+// FPS повертає середню частоту кадрів.
+func (s FrameStats) FPS() float64 {
+	if s.Interval <= 0 {
+		return 0
+	}
+	return float64(time.Second) / float64(s.Interval)
+}
+
+// Stats повертає статистику відправлених кадрів.
+func (l *Loop) Stats() FrameStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.stats
+}
+
+// Post додає нову операцію у внутрішню чергу. Якщо черга заповнена, поведінка залежить від QueuePolicy:
+// з QueueBlock виклик блокується (тому операції циклу не повинні викликати Post для заповненої черги),
+// а з QueueReject повертається ErrQueueFull. Метод можна викликати з будь-яких горутин; після того, як цикл
+// виконав запит на зупинку, операції не додаються і повертається ErrStopped.
+func (l *Loop) Post(op Operation) error {
+	return l.PostContext(context.Background(), op)
+}
+
+// PostContext працює як Post, але з QueueBlock чекає на місце у черзі лише доти, доки не завершиться ctx.
+// У такому разі операція не додається, а повертається помилка ctx.
+func (l *Loop) PostContext(ctx context.Context, op Operation) error {
+	return l.mq.push(ctx, op, false)
+}
+
+// Result описує результат виконання операції, переданої через Exec.
+type Result struct {
+	Updated bool   // Чи була текстура відправлена у Receiver після виконання операції
+	Frame   uint64 // Номер останнього відправленого кадру
+}
+
+// execOp позначає операцію, про виконання якої потрібно повідомити через канал done.
+type execOp struct {
+	Operation
+	done chan Result
+	err  error // Помилка виконання; записується перед відправленням у done
+}
+
+// Exec додає операцію у чергу та блокується, доки цикл не виконає її, або доки не завершиться ctx. Якщо ctx
+// завершився ще до того, як у заповненій черзі з'явилося місце, операція не додається і не виконується.
+// Якщо операцію не вдалося додати у чергу або її було відкинуто, повертається ErrQueueFull чи ErrDropped,
+// а якщо операція завершилася панікою - *OperationError.
+func (l *Loop) Exec(ctx context.Context, op Operation) (Result, error) {
+	e := &execOp{Operation: op, done: make(chan Result, 1)}
+	if err := l.PostContext(ctx, e); err != nil {
+		return Result{}, err
+	}
+
+	select {
+	case res, ok := <-e.done:
+		if !ok {
+			return Result{}, ErrDropped
+		}
+		return res, e.err
+	case <-ctx.Done():
+		return Result{}, ctx.Err()
+	}
 }
 
+// Frame повертає кількість кадрів, відправлених у Receiver з моменту запуску циклу.
+func (l *Loop) Frame() uint64 {
+	return l.frame.Load()
+}
+
+// LastFrame повертає копію сцени, з якої був сформований останній відправлений у Receiver кадр, та номер цього кадру.
+// Якщо жодного кадру ще не було, повертає nil.
+func (l *Loop) LastFrame() (*Scene, uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.last == nil {
+		return nil, 0
+	}
+	return l.last.Clone(), l.frame.Load()
+}
+
+// Scene повертає копію поточного стану сцени, включно зі змінами, які ще не були відображені.
+// Метод не можна викликати з операцій, що виконуються циклом.
+func (l *Loop) Scene() *Scene {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.scene == nil {
+		return NewScene()
+	}
+	return l.scene.Clone()
+}
+
+// Pending повертає кількість операцій, які очікують на виконання у черзі.
+func (l *Loop) Pending() int {
+	return l.mq.len()
+}
+
+// FrameEvent описує кадр, відправлений у Receiver.
+type FrameEvent struct {
+	Frame uint64    // Номер кадру
+	Time  time.Time // Час відправлення кадру
+	Ops   []string  // Описи операцій, виконаних після попереднього кадру (лише тих, що реалізують fmt.Stringer)
+	Scene *Scene    // Стан сцени у кадрі. Спільний для всіх підписників, тому його не можна змінювати
+}
+
+// Subscribe підписується на події про нові кадри. Події надсилаються без блокування циклу: якщо буфер каналу
+// заповнений, подія для цього підписника пропускається. Повернена функція скасовує підписку та закриває канал.
+func (l *Loop) Subscribe(buffer int) (<-chan FrameEvent, func()) {
+	ch := make(chan FrameEvent, buffer)
+
+	l.subMu.Lock()
+	if l.subs == nil {
+		l.subs = make(map[chan FrameEvent]struct{})
+	}
+	l.subs[ch] = struct{}{}
+	l.subMu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			l.subMu.Lock()
+			delete(l.subs, ch)
+			l.subMu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+func (l *Loop) publish(e FrameEvent) {
+	l.subMu.Lock()
+	defer l.subMu.Unlock()
+
+	for ch := range l.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// ErrNotStarted повертається зі Stop, якщо цикл не було запущено.
+var ErrNotStarted = errors.New("painter: loop is not started")
+
 // StopAndWait сигналізує про необхідність завершити цикл та блокується до моменту його повної зупинки.
 func (l *Loop) StopAndWait() {
-	l.Post(OperationFunc(func(texture screen.Texture) {
-		l.stopReq = true
-	}))
+	_ = l.Stop(context.Background())
+}
+
+// Stop сигналізує про необхідність завершити цикл та чекає на його зупинку, доки не завершиться ctx. Операції,
+// додані до того, як цикл дійшов до запиту на зупинку, виконуються; пізніші виклики Post повертають ErrStopped.
+// Якщо цикл не встиг зупинитися, повертає помилку ctx, а цикл завершиться пізніше. Stop можна викликати
+// повторно та з кількох горутин.
+func (l *Loop) Stop(ctx context.Context) error {
+	if l.stop == nil {
+		return ErrNotStarted
+	}
+	// Операція зупинки додається навіть у заповнену чергу і ніколи не відкидається. Якщо черга вже закрита,
+	// залишається лише дочекатися завершення циклу.
+	_ = l.mq.push(context.Background(), stopOp{&l.mq}, true)
+
 	// Виконання заблокується поки хтось не напише щось в канал
 	// Або він не закриється
-	<-l.stop
+	select {
+	case <-l.stop:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// stopOp закриває чергу: нові операції більше не приймаються, а цикл завершується, щойно виконає ті,
+// що залишилися у черзі.
+type stopOp struct {
+	mq *messageQueue
+}
+
+func (op stopOp) Do(screen.Texture, *Scene) bool {
+	op.mq.close()
+	return false
 }
 
 // Черга подій.
@@ -70,30 +471,131 @@ type messageQueue struct {
 	messages []Operation
 	mu       sync.Mutex
 
-	signal chan struct{}
+	capacity int
+	policy   QueuePolicy
+	coalesce bool
+
+	signal chan struct{} // Закривається, коли у порожню чергу додається операція
+	space  chan struct{} // Закривається, коли із заповненої черги забирається операція
+	closed bool          // Чи закрита черга для нових операцій
+}
+
+// push додає операцію у чергу. Операції з force додаються незалежно від обмеження розміру черги.
+// Очікування на місце у черзі переривається завершенням ctx.
+func (mq *messageQueue) push(ctx context.Context, op Operation, force bool) error {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+
+	if mq.closed {
+		return ErrStopped
+	}
+	if mq.coalesce && mq.merge(op) {
+		return nil
+	}
+
+	for !force && mq.capacity > 0 && len(mq.messages) >= mq.capacity {
+		switch mq.policy {
+		case QueueReject:
+			return ErrQueueFull
+		case QueueDropOldest:
+			if !mq.dropOldest() {
+				force = true
+			}
+		default:
+			if mq.space == nil {
+				mq.space = make(chan struct{})
+			}
+			space := mq.space
+			mq.mu.Unlock()
+			var err error
+			select {
+			case <-space:
+			case <-ctx.Done():
+				err = ctx.Err()
+			}
+			mq.mu.Lock()
+
+			if err != nil {
+				return err
+			}
+			if mq.closed {
+				return ErrStopped
+			}
+		}
+	}
+
+	if i := mq.insertPos(op); i < len(mq.messages) {
+		mq.messages = slices.Insert(mq.messages, i, op)
+	} else {
+		mq.messages = append(mq.messages, op)
+	}
+
+	mq.wake()
+	return nil
 }
 
-func (mq *messageQueue) push(op Operation) {
+// configure задає обмеження розміру черги, політику її переповнення та злиття операцій.
+func (mq *messageQueue) configure(capacity int, policy QueuePolicy, coalesce bool) {
 	mq.mu.Lock()
 	defer mq.mu.Unlock()
 
-	mq.messages = append(mq.messages, op)
+	mq.capacity, mq.policy, mq.coalesce = capacity, policy, coalesce
+}
 
+// close закриває чергу для нових операцій. Ті, хто чекає на місце в черзі, отримують ErrStopped.
+func (mq *messageQueue) close() {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+
+	mq.closed = true
+	mq.wake()
+}
+
+// wake будить тих, хто чекає на зміну черги. Викликається з утриманим mu.
+func (mq *messageQueue) wake() {
 	if mq.signal != nil {
 		close(mq.signal)
 		mq.signal = nil
 	}
+	if mq.closed && mq.space != nil {
+		close(mq.space)
+		mq.space = nil
+	}
+}
+
+// dropOldest видаляє з черги найстарішу операцію, крім операції зупинки. Той, хто чекає на відкинуту операцію
+// через Exec, отримує ErrDropped. Повертає false, якщо відкинути нічого не вдалося.
+func (mq *messageQueue) dropOldest() bool {
+	for i, op := range mq.messages {
+		if _, ok := op.(stopOp); ok {
+			continue
+		}
+		if e, ok := op.(*execOp); ok {
+			close(e.done)
+		}
+		n := copy(mq.messages[i:], mq.messages[i+1:])
+		mq.messages[i+n] = nil
+		mq.messages = mq.messages[:i+n]
+		return true
+	}
+	return false
 }
 
-func (mq *messageQueue) pull() Operation {
+// pull забирає першу операцію з черги, чекаючи на неї, якщо черга порожня. Повертає false, якщо черга закрита
+// і всі операції з неї вже забрано.
+func (mq *messageQueue) pull() (Operation, bool) {
 	mq.mu.Lock()
 	defer mq.mu.Unlock()
 
 	for len(mq.messages) == 0 {
-		mq.signal = make(chan struct{})
+		if mq.closed {
+			return nil, false
+		}
+		// Канал читається через локальну змінну: після Unlock поле signal може змінити push.
+		signal := make(chan struct{})
+		mq.signal = signal
 		mq.mu.Unlock()
-		<-mq.signal
-		//mq.signal = nil
+		<-signal
 		mq.mu.Lock()
 	}
 
@@ -101,7 +603,18 @@ func (mq *messageQueue) pull() Operation {
 	mq.messages[0] = nil
 	mq.messages = mq.messages[1:]
 
-	return res
+	if mq.space != nil {
+		close(mq.space)
+		mq.space = nil
+	}
+	return res, true
+}
+
+func (mq *messageQueue) len() int {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+
+	return len(mq.messages)
 }
 
 func (mq *messageQueue) empty() bool {
@@ -1,13 +1,19 @@
 package painter
 
 import (
+	"context"
+	"errors"
 	"image"
 	"image/color"
 	"image/draw"
 	"reflect"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"golang.org/x/exp/shiny/screen"
+
+	"github.com/roman-mazur/architecture-lab-3/ui/headless"
 )
 
 func TestLoop_Post(t *testing.T) {
@@ -28,13 +34,13 @@ func TestLoop_Post(t *testing.T) {
 		go l.Post(logOp(t, "do green fill", GreenFill))
 	}
 
-	l.Post(OperationFunc(func(screen.Texture) {
+	l.Post(OperationFunc(func(*Scene) {
 		testOps = append(testOps, "op 1")
-		l.Post(OperationFunc(func(screen.Texture) {
+		l.Post(OperationFunc(func(*Scene) {
 			testOps = append(testOps, "op 3")
 		}))
 	}))
-	l.Post(OperationFunc(func(screen.Texture) {
+	l.Post(OperationFunc(func(*Scene) {
 		testOps = append(testOps, "op 2")
 	}))
 
@@ -59,10 +65,443 @@ func TestLoop_Post(t *testing.T) {
 	}
 }
 
+func TestLoop_IndependentScenes(t *testing.T) {
+	fills := map[string]OperationFunc{
+		"white": WhiteFill,
+		"green": GreenFill,
+	}
+	for name, fill := range fills {
+		name, fill := name, fill
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				l  Loop
+				tr testReceiver
+			)
+			l.Receiver = &tr
+
+			l.Start(mockScreen{})
+			for i := 0; i < 100; i++ {
+				l.Post(fill)
+				l.Post(OperationFunc(func(s *Scene) {
+					DrawFigure(s, Figure{X: 0.5, Y: 0.5, Color: DefaultFigureColor})
+				}))
+			}
+			l.Post(UpdateOp)
+			l.StopAndWait()
+
+			if len(l.scene.Figures) != 100 {
+				t.Errorf("Scene contains %d figures, expected 100", len(l.scene.Figures))
+			}
+			want := NewScene()
+			fill(want)
+			if l.scene.Bgc != want.Bgc {
+				t.Errorf("Unexpected background %v, expected %v", l.scene.Bgc, want.Bgc)
+			}
+		})
+	}
+}
+
+func TestLoop_Size(t *testing.T) {
+	var (
+		l  Loop
+		tr testReceiver
+	)
+	l.Receiver = &tr
+	l.Size = image.Pt(1920, 1080)
+
+	l.Start(mockScreen{})
+	l.Post(UpdateOp)
+	l.StopAndWait()
+
+	if tr.lastTexture == nil {
+		t.Fatal("Texture was not updated")
+	}
+	if got := tr.lastTexture.Size(); got != l.Size {
+		t.Errorf("Texture size is %v, expected %v", got, l.Size)
+	}
+}
+
+func TestLoop_Exec(t *testing.T) {
+	var (
+		l  Loop
+		tr testReceiver
+	)
+	l.Receiver = &tr
+	l.Start(mockScreen{})
+	defer l.StopAndWait()
+
+	res, err := l.Exec(context.Background(), OperationFunc(WhiteFill))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Updated || res.Frame != 0 {
+		t.Error("Unexpected result for operation without update:", res)
+	}
+
+	for i := uint64(1); i <= 3; i++ {
+		res, err = l.Exec(context.Background(), OperationList{OperationFunc(GreenFill), UpdateOp})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.Updated || res.Frame != i {
+			t.Errorf("Unexpected result %+v, expected frame %d", res, i)
+		}
+	}
+	if l.Frame() != 3 {
+		t.Error("Unexpected frame number:", l.Frame())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	blocked := make(chan struct{})
+	l.Post(OperationFunc(func(*Scene) { <-blocked }))
+	if _, err := l.Exec(ctx, UpdateOp); err != context.Canceled {
+		t.Error("Exec did not respect context cancellation:", err)
+	}
+	close(blocked)
+}
+
+func TestLoop_QueuePolicy(t *testing.T) {
+	// Цикл виконує операцію, яка чекає на unblock, тому наступні операції залишаються у черзі.
+	start := func(l *Loop) (unblock func()) {
+		l.Receiver = &testReceiver{}
+		l.Start(mockScreen{})
+		started, blocked := make(chan struct{}), make(chan struct{})
+		l.Post(OperationFunc(func(*Scene) {
+			close(started)
+			<-blocked
+		}))
+		<-started
+		return func() { close(blocked) }
+	}
+
+	t.Run("reject", func(t *testing.T) {
+		l := Loop{QueueCap: 2, QueuePolicy: QueueReject}
+		unblock := start(&l)
+
+		for i := 0; i < 2; i++ {
+			if err := l.Post(OperationFunc(WhiteFill)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := l.Post(OperationFunc(WhiteFill)); !errors.Is(err, ErrQueueFull) {
+			t.Error("Post to a full queue returned", err)
+		}
+		if _, err := l.Exec(context.Background(), UpdateOp); !errors.Is(err, ErrQueueFull) {
+			t.Error("Exec with a full queue returned", err)
+		}
+		if l.Pending() != 2 {
+			t.Error("Unexpected queue length:", l.Pending())
+		}
+
+		unblock()
+		l.StopAndWait()
+	})
+
+	t.Run("drop oldest", func(t *testing.T) {
+		l := Loop{QueueCap: 2, QueuePolicy: QueueDropOldest}
+		unblock := start(&l)
+
+		var ran []string
+		record := func(name string) Operation {
+			return OperationFunc(func(*Scene) { ran = append(ran, name) })
+		}
+
+		dropped := make(chan error)
+		go func() {
+			_, err := l.Exec(context.Background(), record("a"))
+			dropped <- err
+		}()
+		for l.Pending() != 1 {
+			time.Sleep(time.Millisecond)
+		}
+		l.Post(record("b"))
+		l.Post(record("c"))
+
+		if err := <-dropped; !errors.Is(err, ErrDropped) {
+			t.Error("Exec of a dropped operation returned", err)
+		}
+
+		unblock()
+		l.StopAndWait()
+		if !reflect.DeepEqual(ran, []string{"b", "c"}) {
+			t.Error("Unexpected operations:", ran)
+		}
+	})
+
+	t.Run("block", func(t *testing.T) {
+		l := Loop{QueueCap: 1}
+		unblock := start(&l)
+
+		l.Post(OperationFunc(WhiteFill))
+		posted := make(chan error)
+		go func() {
+			posted <- l.Post(OperationFunc(GreenFill))
+		}()
+
+		select {
+		case <-posted:
+			t.Fatal("Post did not block on a full queue")
+		case <-time.After(20 * time.Millisecond):
+		}
+		unblock()
+		if err := <-posted; err != nil {
+			t.Error(err)
+		}
+		l.StopAndWait()
+	})
+
+	t.Run("block with deadline", func(t *testing.T) {
+		l := Loop{QueueCap: 1}
+		unblock := start(&l)
+
+		l.Post(OperationFunc(WhiteFill))
+		var ran atomic.Bool
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		begin := time.Now()
+		_, err := l.Exec(ctx, OperationFunc(func(*Scene) { ran.Store(true) }))
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Error("Exec with a full queue returned", err)
+		}
+		if elapsed := time.Since(begin); elapsed > time.Second {
+			t.Errorf("Exec ignored the deadline and returned after %s", elapsed)
+		}
+		if err := l.PostContext(ctx, OperationFunc(GreenFill)); !errors.Is(err, context.DeadlineExceeded) {
+			t.Error("PostContext with an expired context returned", err)
+		}
+		if l.Pending() != 1 {
+			t.Error("Unexpected queue length:", l.Pending())
+		}
+
+		unblock()
+		l.StopAndWait()
+		if ran.Load() {
+			t.Error("Operation was executed after Exec gave up")
+		}
+	})
+}
+
+func TestLoop_MaxFPS(t *testing.T) {
+	var (
+		l  = Loop{MaxFPS: 20}
+		tr testReceiver
+	)
+	l.Receiver = &tr
+	l.Start(mockScreen{})
+	defer l.StopAndWait()
+
+	started, blocked := make(chan struct{}), make(chan struct{})
+	l.Post(OperationFunc(func(*Scene) {
+		close(started)
+		<-blocked
+	}))
+	<-started
+	for i := 0; i < 10; i++ {
+		l.Post(OperationFunc(GreenFill))
+		l.Post(UpdateOp)
+	}
+	l.Post(OperationFunc(WhiteFill))
+
+	// Exec потрапляє у чергу ще до того, як цикл почне її розбирати: інакше цикл може встигнути відобразити
+	// відкладений кадр раніше.
+	type execResult struct {
+		res Result
+		err error
+	}
+	done := make(chan execResult, 1)
+	go func() {
+		res, err := l.Exec(context.Background(), UpdateOp)
+		done <- execResult{res, err}
+	}()
+	for l.Pending() < 22 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Перше оновлення відображається одразу, а решта, разом з оновленням з Exec, об'єднуються в один кадр,
+	// який через 50 мс вже містить білий фон.
+	begin := time.Now()
+	close(blocked)
+	first := <-done
+	if first.err != nil {
+		t.Fatal(first.err)
+	}
+	if first.res.Frame != 2 {
+		t.Errorf("Unexpected result %+v", first.res)
+	}
+	if res, err := l.Exec(context.Background(), UpdateOp); err != nil || res.Frame != 3 {
+		t.Fatal("Unexpected result", res, err)
+	}
+	if elapsed := time.Since(begin); elapsed < 90*time.Millisecond {
+		t.Errorf("Frames were not paced: 3 frames took %s", elapsed)
+	}
+
+	stats := l.Stats()
+	if stats.Frames != 3 || stats.Merged != 9 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	if stats.Interval < 45*time.Millisecond || stats.FPS() > 21 {
+		t.Errorf("Unexpected frame interval %s (%.1f FPS)", stats.Interval, stats.FPS())
+	}
+	if mt := tr.lastTexture.(*mockTexture); mt.Colors[len(mt.Colors)-1] != color.White {
+		t.Error("Last frame does not show the latest state:", mt.Colors)
+	}
+}
+
+func TestLoop_Start(t *testing.T) {
+	var l Loop
+	if err := l.Start(failingScreen{}); err == nil {
+		t.Error("Start did not report the texture error")
+	}
+	if err := l.Stop(context.Background()); !errors.Is(err, ErrNotStarted) {
+		t.Error("Stop of a loop that failed to start returned", err)
+	}
+}
+
+func TestLoop_Stop(t *testing.T) {
+	var (
+		l  Loop
+		tr testReceiver
+	)
+	l.Receiver = &tr
+	if err := l.Start(mockScreen{}); err != nil {
+		t.Fatal(err)
+	}
+
+	blocked := make(chan struct{})
+	l.Post(OperationFunc(func(*Scene) { <-blocked }))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := l.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("Stop of a stuck loop returned", err)
+	}
+
+	close(blocked)
+	if err := l.Stop(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLoop_Panic(t *testing.T) {
+	var (
+		l      Loop
+		tr     testReceiver
+		errs   []error
+		report = make(chan struct{}, 1)
+	)
+	l.Receiver = &tr
+	l.OnError = func(err error) {
+		errs = append(errs, err)
+		report <- struct{}{}
+	}
+	if err := l.Start(mockScreen{}); err != nil {
+		t.Fatal(err)
+	}
+
+	l.Post(OperationFunc(func(*Scene) { panic("boom") }))
+	<-report
+
+	// Після паніки цикл продовжує виконувати операції.
+	_, err := l.Exec(context.Background(), OperationList{OperationFunc(WhiteFill), UpdateOp})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = l.Exec(context.Background(), OperationFunc(func(*Scene) { panic(errors.New("exec boom")) }))
+	var oe *OperationError
+	if !errors.As(err, &oe) || oe.Panic.(error).Error() != "exec boom" || len(oe.Stack) == 0 {
+		t.Error("Exec did not return the panic:", err)
+	}
+	<-report
+
+	l.StopAndWait()
+	if len(errs) != 2 {
+		t.Fatal("Unexpected errors:", errs)
+	}
+	if !errors.As(errs[0], &oe) || oe.Panic != "boom" {
+		t.Error("Unexpected error:", errs[0])
+	}
+	if l.Frame() != 1 {
+		t.Error("Unexpected frame number:", l.Frame())
+	}
+}
+
+func TestLoop_PanicRedraw(t *testing.T) {
+	var (
+		l  Loop
+		pr pixelReceiver
+	)
+	l.Receiver = &pr
+	l.Size = image.Pt(4, 4)
+	l.OnError = func(error) {}
+	if err := l.Start(headless.Screen{}); err != nil {
+		t.Fatal(err)
+	}
+
+	l.Post(OperationList{OperationFunc(WhiteFill), UpdateOp})
+	l.Post(OperationList{OperationFunc(GreenFill), UpdateOp})
+	// Операція з панікою не малює на текстурі, тому наступний кадр має бути сформований зі сцени,
+	// а не взятий з текстури, яка містить кадр до попереднього.
+	l.Post(OperationFunc(func(*Scene) { panic("boom") }))
+	l.Post(UpdateOp)
+	l.StopAndWait()
+
+	green := color.RGBA{G: 0xff, A: 0xff}
+	want := []color.RGBA{{R: 0xff, G: 0xff, B: 0xff, A: 0xff}, green, green}
+	if !reflect.DeepEqual(pr.pixels, want) {
+		t.Errorf("Receiver got pixels %v, expected %v", pr.pixels, want)
+	}
+}
+
+func TestLoop_NonDrawingOpRedraw(t *testing.T) {
+	var (
+		l  Loop
+		pr pixelReceiver
+	)
+	l.Receiver = &pr
+	l.Size = image.Pt(4, 4)
+	if err := l.Start(headless.Screen{}); err != nil {
+		t.Fatal(err)
+	}
+
+	l.Post(OperationList{OperationFunc(GreenFill), UpdateOp})
+	l.Post(OperationList{OperationFunc(WhiteFill), UpdateOp})
+	// Операція, яка нічого не малює, не повинна змусити цикл відправити текстуру з кадром до попереднього.
+	l.Post(noopOp{})
+	l.Post(UpdateOp)
+	l.StopAndWait()
+
+	white := color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	want := []color.RGBA{{G: 0xff, A: 0xff}, white, white}
+	if !reflect.DeepEqual(pr.pixels, want) {
+		t.Errorf("Receiver got pixels %v, expected %v", pr.pixels, want)
+	}
+}
+
+// noopOp - операція, яка не змінює ні сцену, ні текстуру.
+type noopOp struct{}
+
+func (noopOp) Do(screen.Texture, *Scene) bool {
+	return false
+}
+
+// pixelReceiver запам'ятовує колір лівого верхнього пікселя кожного отриманого кадру.
+type pixelReceiver struct {
+	pixels []color.RGBA
+}
+
+func (pr *pixelReceiver) Update(t screen.Texture) {
+	pr.pixels = append(pr.pixels, t.(*headless.Texture).RGBA().RGBAAt(0, 0))
+}
+
 func logOp(t *testing.T, msg string, op OperationFunc) OperationFunc {
-	return func(tx screen.Texture) {
+	return func(s *Scene) {
 		t.Log(msg)
-		op(tx)
+		op(s)
 	}
 }
 
@@ -81,20 +520,36 @@ func (m mockScreen) NewBuffer(size image.Point) (screen.Buffer, error) {
 }
 
 func (m mockScreen) NewTexture(size image.Point) (screen.Texture, error) {
-	return new(mockTexture), nil
+	return &mockTexture{size: size}, nil
 }
 
 func (m mockScreen) NewWindow(opts *screen.NewWindowOptions) (screen.Window, error) {
 	panic("implement me")
 }
 
+type failingScreen struct {
+	mockScreen
+}
+
+func (failingScreen) NewTexture(size image.Point) (screen.Texture, error) {
+	return nil, errors.New("no textures")
+}
+
 type mockTexture struct {
 	Colors []color.Color
+	Rects  []image.Rectangle
+
+	size image.Point
 }
 
 func (m *mockTexture) Release() {}
 
-func (m *mockTexture) Size() image.Point { return size }
+func (m *mockTexture) Size() image.Point {
+	if m.size == (image.Point{}) {
+		return DefaultSize
+	}
+	return m.size
+}
 
 func (m *mockTexture) Bounds() image.Rectangle {
 	return image.Rectangle{Max: m.Size()}
@@ -103,4 +558,5 @@ func (m *mockTexture) Bounds() image.Rectangle {
 func (m *mockTexture) Upload(dp image.Point, src screen.Buffer, sr image.Rectangle) {}
 func (m *mockTexture) Fill(dr image.Rectangle, src color.Color, op draw.Op) {
 	m.Colors = append(m.Colors, src)
+	m.Rects = append(m.Rects, dr)
 }
@@ -1,23 +1,27 @@
 package painter
 
 import (
-	"golang.org/x/exp/shiny/screen"
+	"fmt"
 	"image"
 	"image/color"
+	"math"
+	"path"
+
+	"golang.org/x/exp/shiny/screen"
 )
 
-// Operation змінює вхідну текстуру.
+// Operation змінює стан сцени та вхідну текстуру.
 type Operation interface {
 	// Do виконує зміну операції, повертаючи true, якщо текстура вважається готовою для відображення.
-	Do(t screen.Texture) (ready bool)
+	Do(t screen.Texture, s *Scene) (ready bool)
 }
 
 // OperationList групує список операції в одну.
 type OperationList []Operation
 
-func (ol OperationList) Do(t screen.Texture) (ready bool) {
+func (ol OperationList) Do(t screen.Texture, s *Scene) (ready bool) {
 	for _, o := range ol {
-		ready = o.Do(t) || ready
+		ready = o.Do(t, s) || ready
 	}
 	return
 }
@@ -27,112 +31,226 @@ var UpdateOp = updateOp{}
 
 type updateOp struct{}
 
-func (op updateOp) Do(t screen.Texture) bool {
+func (op updateOp) Do(t screen.Texture, s *Scene) bool {
 	return true
 }
 
-// OperationFunc використовується для перетворення функції оновлення текстури в Operation.
-type OperationFunc func(t screen.Texture)
+func (op updateOp) String() string {
+	return "update"
+}
 
-func (f OperationFunc) Do(t screen.Texture) bool {
-	f(t)
-	CreateTexture(t)
+// describe повертає описи операцій, які реалізують fmt.Stringer, розгортаючи списки операцій.
+func describe(names []string, op Operation) []string {
+	switch op := op.(type) {
+	case OperationList:
+		for _, o := range op {
+			names = describe(names, o)
+		}
+	case *execOp:
+		names = describe(names, op.Operation)
+	case fmt.Stringer:
+		names = append(names, op.String())
+	}
+	return names
+}
+
+// OperationFunc використовується для перетворення функції зміни стану сцени в Operation.
+// Після виконання функції текстура перемальовується відповідно до нового стану сцени.
+type OperationFunc func(s *Scene)
+
+func (f OperationFunc) Do(t screen.Texture, s *Scene) bool {
+	f(s)
+	CreateTexture(t, s)
 	return false
 }
 
-type textureData struct {
+// Кольори, якими малюються фігури, якщо колір не вказано явно.
+var (
+	DefaultBgColor     color.Color = color.Black
+	DefaultRectColor   color.Color = color.Black
+	DefaultFigureColor color.Color = color.RGBA{R: 0xff, G: 0xff, A: 0xff}
+)
+
+// Scene зберігає стан полотна, з якого формується текстура. Кожен Loop має власну сцену,
+// тому декілька циклів подій в одному процесі не впливають один на одного.
+type Scene struct {
 	Bgc     color.Color
-	BRec    []float64
-	Figures [][]float64
+	BRects  []Rect // Прямокутники на фоні у порядку їх додавання
+	Figures []Figure
+}
+
+// Rect - прямокутник на фоні, заданий відносними координатами кутів x1,y1,x2,y2.
+type Rect struct {
+	X1, Y1, X2, Y2 float64
+	Color          color.Color
 }
 
-var tData = textureData{
-	Bgc: color.Black,
+// Figure - фігура варіанта (буква Т) з центром у відносних координатах X,Y.
+type Figure struct {
+	ID    string // Необов'язковий ідентифікатор, за яким фігуру можна перемістити окремо від інших
+	X, Y  float64
+	Scale float64 // Множник розміру фігури; нульове значення відповідає 1
+	Color color.Color
+}
+
+// Розміри фігури відносно меншої сторони текстури. На текстурі 800x800 верхня планка має розмір 400x200,
+// а ніжка - 134x200 пікселів.
+const (
+	figureBarHalfWidth  = 0.25
+	figureBarHeight     = 0.25
+	figureStemHalfWidth = 0.08375
+	figureStemHeight    = 0.25
+)
+
+// FigureRects повертає верхню планку та ніжку фігури (букви Т) з центром у точці c на полотні розміру size.
+// Розміри фігури пропорційні меншій стороні полотна, тому її форма не залежить від роздільної здатності.
+func FigureRects(c image.Point, size image.Point, scale float64) (bar, stem image.Rectangle) {
+	if scale == 0 {
+		scale = 1
+	}
+	unit := float64(min(size.X, size.Y)) * scale
+	px := func(v float64) int {
+		return int(math.Round(v * unit))
+	}
+
+	bar = image.Rect(c.X-px(figureBarHalfWidth), c.Y-px(figureBarHeight), c.X+px(figureBarHalfWidth), c.Y)
+	stem = image.Rect(c.X-px(figureStemHalfWidth), c.Y, c.X+px(figureStemHalfWidth), c.Y+px(figureStemHeight))
+	return
+}
+
+// Matches перевіряє, чи відповідає фігура селектору. Селектор - це ідентифікатор фігури або шаблон у форматі
+// path.Match (наприклад "*" чи "t*"). Порожній селектор відповідає усім фігурам.
+func (f Figure) Matches(selector string) bool {
+	if selector == "" {
+		return true
+	}
+	ok, _ := path.Match(selector, f.ID)
+	return ok
+}
+
+// NewScene створює порожню сцену з чорним фоном.
+func NewScene() *Scene {
+	return &Scene{
+		Bgc: DefaultBgColor,
+	}
+}
+
+// Clone повертає незалежну копію сцени.
+func (s *Scene) Clone() *Scene {
+	return &Scene{
+		Bgc:     s.Bgc,
+		BRects:  append([]Rect(nil), s.BRects...),
+		Figures: append([]Figure(nil), s.Figures...),
+	}
+}
+
+// Fill зафарбовує фон текстури у вказаний колір.
+func Fill(s *Scene, c color.Color) {
+	s.Bgc = c
 }
 
 // WhiteFill зафарбовує текстуру у білий колір. Може бути використана як Operation через OperationFunc(WhiteFill).
-func WhiteFill(t screen.Texture) {
-	tData.Bgc = color.White
+func WhiteFill(s *Scene) {
+	Fill(s, color.White)
 }
 
 // GreenFill зафарбовує текстуру у зелений колір. Може бути використана як Operation через OperationFunc(GreenFill).
-func GreenFill(t screen.Texture) {
-	tData.Bgc = color.RGBA{G: 0xff}
+func GreenFill(s *Scene) {
+	Fill(s, color.RGBA{G: 0xff, A: 0xff})
 }
 
-// DrawBgRect малює на фоні прямокутник чорного кольору у вказаних координатах.
-func DrawBgRect(t screen.Texture, coords []float64) {
-	// Малювання чорного прямокутника в координатах x1,y1,x2,y2
-	tData.BRec = coords
+// DrawBgRect додає на фон прямокутник вказаного кольору у координатах x1,y1,x2,y2. Прямокутники накладаються
+// один на одного у порядку їх додавання.
+func DrawBgRect(s *Scene, coords []float64, c color.Color) {
+	s.BRects = append(s.BRects, Rect{
+		X1:    coords[0],
+		Y1:    coords[1],
+		X2:    coords[2],
+		Y2:    coords[3],
+		Color: c,
+	})
 }
 
-// DrawFigure малює нову фігуру варіанта (буква Т) з центром у вказаних координатах поверх сформованого фону.
-func DrawFigure(t screen.Texture, coords []float64) {
-	// Малювання букви Т в координатах x1,y1
-	tData.Figures = append(tData.Figures, coords)
+// DrawFigure малює нову фігуру варіанта (буква Т) поверх сформованого фону.
+// Якщо на сцені вже є фігура з таким самим непорожнім id, вона замінюється новою.
+func DrawFigure(s *Scene, figure Figure) {
+	if figure.ID != "" {
+		for i := range s.Figures {
+			if s.Figures[i].ID == figure.ID {
+				s.Figures[i] = figure
+				return
+			}
+		}
+	}
+	s.Figures = append(s.Figures, figure)
 }
 
-// Move переміщає усі фігури, попередньо намальовані за допомогою команди figure, у вказані координати.
-func Move(t screen.Texture, coords []float64) {
+// Move переміщає фігури, що відповідають селектору (див. Figure.Matches), у вказані координати.
+func Move(s *Scene, selector string, coords []float64) {
 	// Перенесення фігур (букв Т) за координатами x1,y1
-	for _, figure := range tData.Figures {
-		figure[0] = coords[0]
-		figure[1] = coords[1]
+	for i := range s.Figures {
+		if s.Figures[i].Matches(selector) {
+			s.Figures[i].X = coords[0]
+			s.Figures[i].Y = coords[1]
+		}
+	}
+}
+
+// Translate зсуває фігури, що відповідають селектору, на вказаний вектор dx,dy відносно їх поточного положення.
+func Translate(s *Scene, selector string, delta []float64) {
+	for i := range s.Figures {
+		if s.Figures[i].Matches(selector) {
+			s.Figures[i].X += delta[0]
+			s.Figures[i].Y += delta[1]
+		}
 	}
 }
 
-// Reset очищає весь поточний стан текстури (інформацію про колір фону, чорний прямокутник, усі фігури додані через команду figure). Залишає лише фон з чорним кольором.
-func Reset(t screen.Texture) {
-	// 1. Очищуємо інформацію про поточний стан текстури.
+// Restore замінює стан сцени копією збереженої сцени from.
+func Restore(s *Scene, from *Scene) {
+	*s = *from.Clone()
+}
+
+// Reset очищає весь поточний стан сцени (інформацію про колір фону, усі прямокутники та фігури додані через команду figure). Залишає лише фон з чорним кольором.
+func Reset(s *Scene) {
+	// 1. Очищуємо інформацію про поточний стан сцени.
 	// 2. Замальовуємо фон чорним кольором
-	tData.Bgc = color.Black
-	tData.BRec = tData.BRec[:0]
-	tData.Figures = tData.Figures[:0]
+	s.Bgc = DefaultBgColor
+	s.BRects = s.BRects[:0]
+	s.Figures = s.Figures[:0]
 }
 
-func CreateTexture(t screen.Texture) {
+// CreateTexture малює стан сцени на текстурі.
+func CreateTexture(t screen.Texture, s *Scene) {
 	// Малювання визначеного запитом фону. Дефолтий фон - чорний
-	t.Fill(t.Bounds(), tData.Bgc, screen.Src)
+	t.Fill(t.Bounds(), s.Bgc, screen.Src)
 
-	if len(tData.BRec) > 0 {
+	// Прямокутники та фігури накладаються на фон, тому напівпрозорі кольори змішуються з ним.
+	for _, rect := range s.BRects {
 		rectBody := image.Rectangle{
 			Min: image.Point{
-				X: int(tData.BRec[0] * float64(t.Size().X)),
-				Y: int(tData.BRec[1] * float64(t.Size().Y)),
+				X: int(rect.X1 * float64(t.Size().X)),
+				Y: int(rect.Y1 * float64(t.Size().Y)),
 			},
 			Max: image.Point{
-				X: int(tData.BRec[2] * float64(t.Size().X)),
-				Y: int(tData.BRec[3] * float64(t.Size().Y)),
+				X: int(rect.X2 * float64(t.Size().X)),
+				Y: int(rect.Y2 * float64(t.Size().Y)),
 			},
 		}
-		t.Fill(rectBody, color.Black, screen.Src)
+		t.Fill(rectBody, rect.Color, screen.Over)
 	}
 
-	for _, figure := range tData.Figures {
-		figureBody1 := image.Rectangle{
-			Min: image.Point{
-				X: int(figure[0]*float64(t.Size().X)) - 200,
-				Y: int(figure[1]*float64(t.Size().Y)) - 200,
-			},
-			Max: image.Point{
-				X: int(figure[0]*float64(t.Size().X)) + 200,
-				Y: int(figure[1] * float64(t.Size().Y)),
-			},
+	for _, figure := range s.Figures {
+		center := image.Point{
+			X: int(figure.X * float64(t.Size().X)),
+			Y: int(figure.Y * float64(t.Size().Y)),
 		}
-		figureColor1 := color.RGBA{R: 0xff, G: 0xff}
-		t.Fill(figureBody1, figureColor1, screen.Src)
+		bar, stem := FigureRects(center, t.Size(), figure.Scale)
+		t.Fill(bar, figure.Color, screen.Over)
+		t.Fill(stem, figure.Color, screen.Over)
+	}
 
-		figureBody2 := image.Rectangle{
-			Min: image.Point{
-				X: int(figure[0]*float64(t.Size().X)) - 67,
-				Y: int(figure[1] * float64(t.Size().Y)),
-			},
-			Max: image.Point{
-				X: int(figure[0]*float64(t.Size().X)) + 67,
-				Y: int(figure[1]*float64(t.Size().Y)) + 200,
-			},
-		}
-		figureColor2 := color.RGBA{R: 0xff, G: 0xff}
-		t.Fill(figureBody2, figureColor2, screen.Src)
+	if ft, ok := t.(*frameTexture); ok {
+		ft.drawn = true
 	}
 }
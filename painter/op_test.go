@@ -0,0 +1,118 @@
+package painter
+
+import (
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+func TestCreateTexture_BgRects(t *testing.T) {
+	s := NewScene()
+	red := color.RGBA{R: 0xff, A: 0xff}
+	blue := color.RGBA{B: 0xff, A: 0xff}
+
+	DrawBgRect(s, []float64{0.1, 0.1, 0.5, 0.5}, red)
+	DrawBgRect(s, []float64{0.3, 0.3, 0.9, 0.9}, blue)
+
+	var mt mockTexture
+	CreateTexture(&mt, s)
+	if want := []color.Color{DefaultBgColor, red, blue}; !reflect.DeepEqual(mt.Colors, want) {
+		t.Error("Rectangles are not drawn in posting order:", mt.Colors)
+	}
+
+	Reset(s)
+	mt.Colors = nil
+	CreateTexture(&mt, s)
+	if want := []color.Color{DefaultBgColor}; !reflect.DeepEqual(mt.Colors, want) {
+		t.Error("Reset did not remove rectangles:", mt.Colors)
+	}
+}
+
+func TestMove_Selector(t *testing.T) {
+	s := NewScene()
+	DrawFigure(s, Figure{ID: "t1", X: 0.1, Y: 0.1, Color: DefaultFigureColor})
+	DrawFigure(s, Figure{ID: "t2", X: 0.2, Y: 0.2, Color: DefaultFigureColor})
+	DrawFigure(s, Figure{X: 0.3, Y: 0.3, Color: DefaultFigureColor})
+
+	Move(s, "t1", []float64{0.5, 0.5})
+	if f := s.Figures[0]; f.X != 0.5 || f.Y != 0.5 {
+		t.Error("Figure t1 was not moved:", f)
+	}
+	if f := s.Figures[1]; f.X != 0.2 || f.Y != 0.2 {
+		t.Error("Figure t2 was moved by selector t1:", f)
+	}
+
+	Move(s, "t*", []float64{0.6, 0.6})
+	if s.Figures[0].X != 0.6 || s.Figures[1].X != 0.6 || s.Figures[2].X != 0.3 {
+		t.Error("Unexpected result of pattern move:", s.Figures)
+	}
+
+	Move(s, "*", []float64{0.7, 0.7})
+	for _, f := range s.Figures {
+		if f.X != 0.7 || f.Y != 0.7 {
+			t.Error("Figure was not moved by \"*\" selector:", f)
+		}
+	}
+
+	DrawFigure(s, Figure{ID: "t2", X: 0.9, Y: 0.9, Color: DefaultFigureColor})
+	if len(s.Figures) != 3 || s.Figures[1].X != 0.9 {
+		t.Error("Figure with existing id was not replaced:", s.Figures)
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	s := NewScene()
+	DrawFigure(s, Figure{ID: "a", X: 0.125, Y: 0.25, Color: DefaultFigureColor})
+	DrawFigure(s, Figure{ID: "b", X: 0.5, Y: 0.6, Color: DefaultFigureColor})
+
+	Translate(s, "", []float64{0.25, -0.125})
+	if f := s.Figures[0]; f.X != 0.375 || f.Y != 0.125 {
+		t.Error("Unexpected position of figure a:", f)
+	}
+	if f := s.Figures[1]; f.X != 0.75 || f.Y != 0.475 {
+		t.Error("Unexpected position of figure b:", f)
+	}
+
+	Translate(s, "b", []float64{0.25, 0.5})
+	if f := s.Figures[0]; f.X != 0.375 {
+		t.Error("Figure a was translated by selector b:", f)
+	}
+	if f := s.Figures[1]; f.X != 1 || f.Y != 0.975 {
+		t.Error("Unexpected position of figure b:", f)
+	}
+}
+
+func TestFigureRects(t *testing.T) {
+	bar, stem := FigureRects(image.Pt(400, 400), image.Pt(800, 800), 1)
+	if want := image.Rect(200, 200, 600, 400); bar != want {
+		t.Errorf("Bar is %v, expected %v", bar, want)
+	}
+	if want := image.Rect(333, 400, 467, 600); stem != want {
+		t.Errorf("Stem is %v, expected %v", stem, want)
+	}
+
+	// Розмір визначається меншою стороною полотна та масштабом фігури.
+	bar, stem = FigureRects(image.Pt(800, 200), image.Pt(1600, 400), 0.5)
+	if want := image.Rect(750, 150, 850, 200); bar != want {
+		t.Errorf("Bar is %v, expected %v", bar, want)
+	}
+	if want := image.Rect(783, 200, 817, 250); stem != want {
+		t.Errorf("Stem is %v, expected %v", stem, want)
+	}
+}
+
+func TestCreateTexture_Size(t *testing.T) {
+	s := NewScene()
+	DrawFigure(s, Figure{X: 0.5, Y: 0.5, Color: DefaultFigureColor})
+
+	mt := mockTexture{size: image.Pt(200, 100)}
+	CreateTexture(&mt, s)
+	if want := []image.Rectangle{
+		image.Rect(0, 0, 200, 100),
+		image.Rect(75, 25, 125, 50),
+		image.Rect(92, 50, 108, 75),
+	}; !reflect.DeepEqual(mt.Rects, want) {
+		t.Error("Unexpected rectangles:", mt.Rects)
+	}
+}
@@ -0,0 +1,185 @@
+package painter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// Тести цього файлу перевіряють взаємодію циклу з багатьма горутинами; їх варто запускати з go test -race.
+
+func TestLoop_PostAfterStop(t *testing.T) {
+	var (
+		l  Loop
+		tr testReceiver
+	)
+	l.Receiver = &tr
+	if err := l.Start(mockScreen{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		accepted, executed atomic.Int64
+		wg                 sync.WaitGroup
+		stopped            = make(chan struct{})
+	)
+	op := OperationFunc(func(*Scene) { executed.Add(1) })
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				err := l.Post(op)
+				switch {
+				case err == nil:
+					accepted.Add(1)
+				case errors.Is(err, ErrStopped):
+					return
+				default:
+					t.Error("Unexpected Post error:", err)
+					return
+				}
+				select {
+				case <-stopped:
+					// Після повернення Stop жодна операція не може бути прийнята.
+					if err := l.Post(op); !errors.Is(err, ErrStopped) {
+						t.Error("Post after Stop returned", err)
+					}
+					return
+				default:
+				}
+			}
+		}()
+	}
+
+	l.Post(UpdateOp)
+	if err := l.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	close(stopped)
+	wg.Wait()
+
+	// Кожна прийнята операція виконана, тобто жодна не залишилася у черзі після зупинки.
+	if accepted.Load() != executed.Load() {
+		t.Errorf("Accepted %d operations, executed %d", accepted.Load(), executed.Load())
+	}
+	if _, err := l.Exec(context.Background(), UpdateOp); !errors.Is(err, ErrStopped) {
+		t.Error("Exec after Stop returned", err)
+	}
+	if err := l.Stop(context.Background()); err != nil {
+		t.Error("Repeated Stop returned", err)
+	}
+}
+
+func TestLoop_Concurrent(t *testing.T) {
+	var (
+		l  = Loop{QueueCap: 16, Coalesce: true}
+		tr testReceiver
+	)
+	l.Receiver = &tr
+	if err := l.Start(mockScreen{}); err != nil {
+		t.Fatal(err)
+	}
+
+	events, cancel := l.Subscribe(4)
+	go func() {
+		for range events {
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				l.Post(OperationFunc(GreenFill))
+				l.Post(UpdateOp)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if _, err := l.Exec(context.Background(), OperationList{OperationFunc(WhiteFill), UpdateOp}); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				l.Scene()
+				l.LastFrame()
+				l.Stats()
+				l.Pending()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Зупинка з кількох горутин одночасно.
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := l.Stop(context.Background()); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	cancel()
+
+	if l.Frame() == 0 {
+		t.Error("No frames were sent")
+	}
+}
+
+func TestLoop_AccessDuringStart(t *testing.T) {
+	var (
+		l  = Loop{QueueCap: 64, Coalesce: true}
+		tr testReceiver
+		wg sync.WaitGroup
+	)
+	l.Receiver = &tr
+
+	// HTTP сервер починає приймати запити ще до того, як цикл буде запущено.
+	started := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; ; j++ {
+				l.Scene()
+				if err := l.Post(OperationFunc(GreenFill)); err != nil {
+					t.Error(err)
+					return
+				}
+				select {
+				case <-started:
+					if j > 0 {
+						return
+					}
+				default:
+				}
+			}
+		}()
+	}
+
+	if err := l.Start(mockScreen{}); err != nil {
+		t.Fatal(err)
+	}
+	close(started)
+	wg.Wait()
+
+	if _, err := l.Exec(context.Background(), UpdateOp); err != nil {
+		t.Fatal(err)
+	}
+	l.StopAndWait()
+	if l.Pending() != 0 {
+		t.Errorf("%d operations left in the queue", l.Pending())
+	}
+}
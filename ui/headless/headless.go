@@ -0,0 +1,112 @@
+// Package headless реалізує screen.Screen, що працює без вікна: текстури зберігаються у пам'яті як image.RGBA.
+// Використовується для запуску painter на машинах без дисплея та для порівняння результатів у тестах.
+package headless
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/exp/shiny/screen"
+)
+
+// ErrNoWindow повертається при спробі створити вікно без дисплея.
+var ErrNoWindow = errors.New("headless screen does not support windows")
+
+// Screen створює буфери та текстури у пам'яті.
+type Screen struct{}
+
+var (
+	_ screen.Screen  = Screen{}
+	_ screen.Texture = (*Texture)(nil)
+)
+
+func (Screen) NewBuffer(size image.Point) (screen.Buffer, error) {
+	return &buffer{rgba: image.NewRGBA(image.Rectangle{Max: size})}, nil
+}
+
+func (Screen) NewTexture(size image.Point) (screen.Texture, error) {
+	return NewTexture(size), nil
+}
+
+func (Screen) NewWindow(opts *screen.NewWindowOptions) (screen.Window, error) {
+	return nil, ErrNoWindow
+}
+
+type buffer struct {
+	rgba *image.RGBA
+}
+
+func (b *buffer) Release()                {}
+func (b *buffer) Size() image.Point       { return b.rgba.Rect.Size() }
+func (b *buffer) Bounds() image.Rectangle { return b.rgba.Rect }
+func (b *buffer) RGBA() *image.RGBA       { return b.rgba }
+
+// Texture - текстура, вміст якої доступний для читання через RGBA.
+type Texture struct {
+	rgba *image.RGBA
+}
+
+// NewTexture створює прозору текстуру вказаного розміру.
+func NewTexture(size image.Point) *Texture {
+	return &Texture{rgba: image.NewRGBA(image.Rectangle{Max: size})}
+}
+
+// RGBA повертає зображення, в яке малює текстура.
+func (t *Texture) RGBA() *image.RGBA { return t.rgba }
+
+func (t *Texture) Release()                {}
+func (t *Texture) Size() image.Point       { return t.rgba.Rect.Size() }
+func (t *Texture) Bounds() image.Rectangle { return t.rgba.Rect }
+
+func (t *Texture) Upload(dp image.Point, src screen.Buffer, sr image.Rectangle) {
+	draw.Draw(t.rgba, sr.Sub(sr.Min).Add(dp), src.RGBA(), sr.Min, draw.Src)
+}
+
+func (t *Texture) Fill(dr image.Rectangle, src color.Color, op draw.Op) {
+	draw.Draw(t.rgba, dr, image.NewUniform(src), image.Point{}, op)
+}
+
+// PNGReceiver записує кожну отриману текстуру у PNG файл, перезаписуючи попередній кадр.
+type PNGReceiver struct {
+	Path string
+}
+
+func (r *PNGReceiver) Update(t screen.Texture) {
+	ht, ok := t.(*Texture)
+	if !ok {
+		log.Printf("Cannot save frame: unsupported texture %T", t)
+		return
+	}
+	if err := WritePNG(r.Path, ht.RGBA()); err != nil {
+		log.Printf("Cannot save frame: %s", err)
+	}
+}
+
+// WritePNG записує зображення у файл. Запис відбувається через тимчасовий файл, тому читачі ніколи не побачать
+// частково записаний кадр.
+func WritePNG(path string, img image.Image) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := f.Chmod(0o644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,57 @@
+package headless
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTexture_Fill(t *testing.T) {
+	tx, err := Screen{}.NewTexture(image.Pt(10, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Fill(tx.Bounds(), color.White, draw.Src)
+	tx.Fill(image.Rect(2, 2, 4, 4), color.Black, draw.Src)
+
+	img := tx.(*Texture).RGBA()
+	if got := img.RGBAAt(0, 0); got != (color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}) {
+		t.Error("Unexpected background color:", got)
+	}
+	if got := img.RGBAAt(3, 3); got != (color.RGBA{A: 0xff}) {
+		t.Error("Unexpected rectangle color:", got)
+	}
+}
+
+func TestPNGReceiver_Update(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "frame.png")
+	r := PNGReceiver{Path: path}
+
+	for _, c := range []color.Color{color.White, color.RGBA{G: 0xff, A: 0xff}} {
+		tx := NewTexture(image.Pt(4, 4))
+		tx.Fill(tx.Bounds(), c, draw.Src)
+		r.Update(tx)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := color.RGBAModel.Convert(img.At(1, 1)); got != (color.RGBA{G: 0xff, A: 0xff}) {
+		t.Error("Frame was not overwritten:", got)
+	}
+
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Error("Temporary files were left behind:", entries)
+	}
+}
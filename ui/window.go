@@ -14,6 +14,8 @@ import (
 	"golang.org/x/mobile/event/mouse"
 	"golang.org/x/mobile/event/paint"
 	"golang.org/x/mobile/event/size"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
 )
 
 type Visualizer struct {
@@ -21,6 +23,9 @@ type Visualizer struct {
 	Debug         bool
 	OnScreenReady func(s screen.Screen)
 
+	// Розмір вікна. Якщо не вказано, використовується DefaultWidth x DefaultHeight.
+	Width, Height int
+
 	w    screen.Window
 	tx   chan screen.Texture
 	done chan struct{}
@@ -30,23 +35,37 @@ type Visualizer struct {
 	bgc color.RGBA
 }
 
+// Розмір вікна за замовчуванням.
+const (
+	DefaultWidth  = 800
+	DefaultHeight = 800
+)
+
 func (pw *Visualizer) Main() {
+	if pw.Width <= 0 || pw.Height <= 0 {
+		pw.Width, pw.Height = DefaultWidth, DefaultHeight
+	}
+
 	pw.tx = make(chan screen.Texture)
 	pw.done = make(chan struct{})
-	pw.pos.X = 400
-	pw.pos.Y = 400
+	pw.pos.X = pw.Width / 2
+	pw.pos.Y = pw.Height / 2
 	driver.Main(pw.run)
 }
 
+// Update передає текстуру у вікно. Після закриття вікна текстури відкидаються, щоб не блокувати цикл подій.
 func (pw *Visualizer) Update(t screen.Texture) {
-	pw.tx <- t
+	select {
+	case pw.tx <- t:
+	case <-pw.done:
+	}
 }
 
 func (pw *Visualizer) run(s screen.Screen) {
 	w, err := s.NewWindow(&screen.NewWindowOptions{
 		Title:  pw.Title,
-		Width:  800,
-		Height: 800,
+		Width:  pw.Width,
+		Height: pw.Height,
 	})
 	if err != nil {
 		log.Fatal("Failed to initialize the app window:", err)
@@ -146,31 +165,10 @@ func (pw *Visualizer) handleEvent(e any, t screen.Texture) {
 func (pw *Visualizer) drawDefaultUI() {
 	pw.w.Fill(pw.sz.Bounds(), color.RGBA{G: 0xff}, draw.Src) // Фон.
 
-	figureBody1 := image.Rectangle{
-		Min: image.Point{
-			X: pw.pos.X - 200,
-			Y: pw.pos.Y - 200,
-		},
-		Max: image.Point{
-			X: pw.pos.X + 200,
-			Y: pw.pos.Y,
-		},
-	}
-	figureColor1 := color.RGBA{R: 0xff, G: 0xff}
-	pw.w.Fill(figureBody1, figureColor1, draw.Src)
-
-	figureBody2 := image.Rectangle{
-		Min: image.Point{
-			X: pw.pos.X - 67,
-			Y: pw.pos.Y,
-		},
-		Max: image.Point{
-			X: pw.pos.X + 67,
-			Y: pw.pos.Y + 200,
-		},
-	}
-	figureColor2 := color.RGBA{R: 0xff, G: 0xff}
-	pw.w.Fill(figureBody2, figureColor2, draw.Src)
+	bar, stem := painter.FigureRects(pw.pos, pw.sz.Size(), 1)
+	figureColor := color.RGBA{R: 0xff, G: 0xff, A: 0xff}
+	pw.w.Fill(bar, figureColor, draw.Src)
+	pw.w.Fill(stem, figureColor, draw.Src)
 
 	// Малювання білої рамки.
 	for _, br := range imageutil.Border(pw.sz.Bounds(), 0) {